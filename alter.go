@@ -0,0 +1,235 @@
+package dasorm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// liveType is the type of a described column as it is written in ddl
+func liveType(col *Column) string {
+	if col.ColumnType != "" {
+		return col.ColumnType
+	}
+	family, ok := typeFamilies[col.DataType]
+	switch {
+	case ok && family == textFamily && col.Length < 0:
+		return col.DataType + "(MAX)"
+	case ok && family == textFamily && col.Length > 0 && !strings.Contains(col.DataType, "TEXT"):
+		return fmt.Sprintf("%s(%d)", col.DataType, col.Length)
+	case ok && family == decimalFamily && col.Precision > 0:
+		return fmt.Sprintf("%s(%d,%d)", col.DataType, col.Precision, col.Scale)
+	}
+	return col.DataType
+}
+
+// widens reports whether the string field is longer than its varchar column
+func widens(f *fieldColumn, col *Column, dialect string) bool {
+	if f.kind != stringColumn || f.custom || col.Length <= 0 || f.length <= col.Length {
+		return false
+	}
+	return strings.Contains(col.DataType, "VAR") || (dialect == "snowflake" && col.DataType == "TEXT")
+}
+
+// liveDefaultSQL is the default of a described mysql column as it is written
+// in ddl. mysql reports string defaults unquoted and flags expressions as
+// DEFAULT_GENERATED.
+func liveDefaultSQL(col *Column) string {
+	if !col.Default.Valid {
+		return ""
+	}
+	def := col.Default.String
+	family, ok := typeFamilies[col.DataType]
+	switch {
+	case ok && family != textFamily && family != timeFamily && family != uuidFamily,
+		strings.Contains(col.Extra, "DEFAULT_GENERATED"),
+		strings.HasPrefix(def, "'"),
+		strings.HasPrefix(strings.ToUpper(def), "CURRENT_TIMESTAMP"),
+		strings.EqualFold(def, "NULL"):
+		return def
+	}
+	return "'" + strings.Replace(def, "'", "''", -1) + "'"
+}
+
+// mysqlAttrsSQL restates the auto increment, on update and comment of a
+// described mysql column, which MODIFY COLUMN drops unless they are repeated
+func mysqlAttrsSQL(col *Column) string {
+	s := ""
+	if col.Identity {
+		s += " AUTO_INCREMENT"
+	}
+	if i := strings.Index(strings.ToLower(col.Extra), "on update "); i >= 0 {
+		s += " ON UPDATE " + col.Extra[i+len("on update "):]
+	}
+	if col.Comment != "" {
+		s += " COMMENT '" + strings.Replace(col.Comment, "'", "''", -1) + "'"
+	}
+	return s
+}
+
+// alterColumnSQL returns the statements changing a live column to a type,
+// default and nullability. mysql and mssql restate the whole column, the
+// others change the type and the nullability separately. mysql keeps the
+// collation, auto increment, on update and comment of the live column and
+// warns about generated ones, whose expression it cannot restate.
+func (d *tableDef) alterColumnSQL(f *fieldColumn, live *Column, dataType, def string, nullable, retype, renull bool) []string {
+	table, col := d.quote(d.name), d.quote(f.name)
+	notNull := " NOT NULL"
+	if nullable {
+		notNull = " NULL"
+	}
+	switch d.dialect {
+	case "mysql":
+		s := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, col, dataType)
+		if live.Collation != "" {
+			s += " COLLATE " + live.Collation
+		}
+		s += notNull
+		if def != "" {
+			s += " DEFAULT " + def
+		}
+		s += mysqlAttrsSQL(live)
+		if live.Generated {
+			s = fmt.Sprintf("-- %s is a generated column: restate its expression or this drops it\n", f.name) + s
+		}
+		return []string{s}
+	case "mssql":
+		return []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s%s", table, col, dataType, notNull)}
+	}
+	stmts := []string{}
+	if retype {
+		setType := "TYPE"
+		if d.dialect == "snowflake" {
+			setType = "SET DATA TYPE"
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s %s", table, col, setType, dataType))
+	}
+	if renull {
+		change := "SET NOT NULL"
+		if nullable {
+			change = "DROP NOT NULL"
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, col, change))
+	}
+	return stmts
+}
+
+// dropIndexSQL drops an index of the table
+func (d *tableDef) dropIndexSQL(idx *tableIndex) string {
+	if d.inlineIndexes() {
+		return fmt.Sprintf("DROP INDEX %s ON %s", d.quote(idx.name), d.quote(d.name))
+	}
+	name := idx.name
+	if i := strings.LastIndex(d.name, "."); i >= 0 {
+		name = d.name[:i+1] + name
+	}
+	return "DROP INDEX IF EXISTS " + d.quote(name)
+}
+
+// modelIndexes are the indexes of the model, unique columns included
+func (d *tableDef) modelIndexes() []*tableIndex {
+	out := []*tableIndex{}
+	for _, col := range d.columns {
+		if col.unique {
+			out = append(out, &tableIndex{name: baseName(d.name) + "_" + col.name + "_key", columns: []string{col.name}, unique: true})
+		}
+	}
+	return append(out, d.indexes...)
+}
+
+// hasIndex reports whether the table has an index over the columns, unique
+// if it must be. the primary key counts as a unique index.
+func hasIndex(t *Table, idx *tableIndex) bool {
+	if sameColumns(t.PrimaryKey, idx.columns) {
+		return true
+	}
+	for _, live := range t.Indexes {
+		if (live.Unique || !idx.unique) && sameColumns(live.Columns, idx.columns) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// alterStmts returns the statements bringing the live table in line with
+// the model, each paired with the one undoing it
+func (d *tableDef) alterStmts(table *Table) (up, down []string) {
+	add := func(u []string, dn ...string) {
+		up = append(up, u...)
+		for _, s := range dn {
+			down = append([]string{s}, down...)
+		}
+	}
+	for _, f := range d.columns {
+		col := table.Column(f.name)
+		if col == nil {
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", d.quote(d.name), d.columnSQL(f))
+			if d.dialect == "mssql" {
+				stmt = fmt.Sprintf("ALTER TABLE %s ADD %s", d.quote(d.name), d.columnSQL(f))
+			}
+			if !f.nullable && f.def == "" {
+				stmt = fmt.Sprintf("-- %s is NOT NULL without a default: this fails if %s has rows\n", f.name, d.name) + stmt
+			}
+			add([]string{stmt}, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", d.quote(d.name), d.quote(f.name)))
+			continue
+		}
+		retype := widens(f, col, d.dialect)
+		renull := f.nullable != col.Nullable
+		if !retype && !renull {
+			continue
+		}
+		oldType, newType := liveType(col), liveType(col)
+		if retype {
+			newType = f.dataType
+		}
+		oldDefault, newDefault := liveDefaultSQL(col), liveDefaultSQL(col)
+		if f.def != "" {
+			newDefault = d.defaultSQL(f)
+		}
+		add(d.alterColumnSQL(f, col, newType, newDefault, f.nullable, retype, renull), d.alterColumnSQL(f, col, oldType, oldDefault, col.Nullable, retype, renull)...)
+	}
+	if d.dialect == "snowflake" {
+		return up, down
+	}
+	for _, idx := range d.modelIndexes() {
+		if !hasIndex(table, idx) {
+			add([]string{d.createIndexSQL(idx)}, d.dropIndexSQL(idx))
+		}
+	}
+	return up, down
+}
+
+// AlterTableStmts compares the `db` fields of a model with its live table
+// and returns the statements adding missing columns, widening varchar
+// columns, changing nullability and adding indexes, in order, and the ones
+// undoing them, in the order to run them. a missing table is created.
+// columns the model does not have are left alone. the statements are meant
+// to be reviewed, see migrate.Diff.
+func (c *Connection) AlterTableStmts(model interface{}) (up, down []string, err error) {
+	def, err := c.tableDef(model)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "alter table")
+	}
+	table, err := c.DescribeTable(def.name)
+	if errors.Cause(err) == ErrNoTable {
+		return def.createStmts(), []string{"DROP TABLE " + def.quote(def.name)}, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "alter table")
+	}
+	up, down = def.alterStmts(table)
+	return up, down, nil
+}
@@ -0,0 +1,119 @@
+package dasorm
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/estenssoros/dasorm/nulls"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type alterUser struct {
+	ID    uuid.UUID    `db:"id"`
+	Email string       `db:"email" dasorm:"size=200,unique"`
+	OrgID nulls.Int    `db:"org_id" dasorm:"index"`
+	Name  nulls.String `db:"name"`
+	Plan  string       `db:"plan" dasorm:"default='free'"`
+	Code  string       `db:"code"`
+}
+
+func (alterUser) TableName() string { return "app.users" }
+
+// alterTable is the live table alterUser is compared with
+var alterTable = &Table{
+	Columns: []*Column{
+		{Name: "id", DataType: "UUID"},
+		{Name: "email", DataType: "CHARACTER VARYING", Length: 120},
+		{Name: "org_id", DataType: "BIGINT"},
+		{Name: "name", DataType: "TEXT", Nullable: true},
+	},
+	PrimaryKey: []string{"id"},
+	Indexes:    []*Index{{Name: "users_email_key", Columns: []string{"email"}, Unique: true}},
+}
+
+// alterCode is a mysql timestamp column updated on every write
+var alterCode = &Column{Name: "code", DataType: "TIMESTAMP", Default: nulls.NewString("CURRENT_TIMESTAMP"), Extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"}
+
+func TestAlterStmts(t *testing.T) {
+	def, err := (&Model{Value: &alterUser{}}).tableDef("postgres")
+	assert.NoError(t, err)
+	up, down := def.alterStmts(alterTable)
+	assert.Equal(t, []string{
+		`ALTER TABLE "app"."users" ALTER COLUMN "email" TYPE VARCHAR(200)`,
+		`ALTER TABLE "app"."users" ALTER COLUMN "org_id" DROP NOT NULL`,
+		`ALTER TABLE "app"."users" ADD COLUMN "plan" VARCHAR(255) NOT NULL DEFAULT 'free'`,
+		"-- code is NOT NULL without a default: this fails if app.users has rows\n" + `ALTER TABLE "app"."users" ADD COLUMN "code" VARCHAR(255) NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS "users_org_id_idx" ON "app"."users" ("org_id")`,
+	}, up)
+	assert.Equal(t, []string{
+		`DROP INDEX IF EXISTS "app"."users_org_id_idx"`,
+		`ALTER TABLE "app"."users" DROP COLUMN "code"`,
+		`ALTER TABLE "app"."users" DROP COLUMN "plan"`,
+		`ALTER TABLE "app"."users" ALTER COLUMN "org_id" SET NOT NULL`,
+		`ALTER TABLE "app"."users" ALTER COLUMN "email" TYPE CHARACTER VARYING(120)`,
+	}, down)
+
+	def, err = (&Model{Value: &alterUser{}}).tableDef("mysql")
+	assert.NoError(t, err)
+	up, down = def.alterStmts(alterTable)
+	assert.Equal(t, "ALTER TABLE `app`.`users` MODIFY COLUMN `email` VARCHAR(200) NOT NULL", up[0])
+	assert.Equal(t, "ALTER TABLE `app`.`users` MODIFY COLUMN `org_id` BIGINT NULL", up[1])
+	assert.Equal(t, "CREATE INDEX `users_org_id_idx` ON `app`.`users` (`org_id`)", up[4])
+	assert.Equal(t, "DROP INDEX `users_org_id_idx` ON `app`.`users`", down[0])
+
+	up, down = def.alterStmts(&Table{
+		Columns: []*Column{
+			{Name: "id", DataType: "CHAR", ColumnType: "char(36)"},
+			{Name: "email", DataType: "VARCHAR", Length: 120, ColumnType: "varchar(120)", Default: nulls.NewString("it's"), Collation: "utf8mb4_bin", Comment: "login"},
+			{Name: "org_id", DataType: "INT", ColumnType: "int unsigned", Default: nulls.NewString("0"), Identity: true, Extra: "auto_increment"},
+			{Name: "name", DataType: "TEXT", Nullable: true},
+			{Name: "plan", DataType: "VARCHAR", Length: 255, Nullable: true, ColumnType: "varchar(255)", Generated: true, Extra: "VIRTUAL GENERATED"},
+			alterCode,
+		},
+		PrimaryKey: []string{"id"},
+		Indexes:    []*Index{{Name: "users_email_key", Columns: []string{"email"}, Unique: true}, {Name: "users_org", Columns: []string{"org_id"}}},
+	})
+	assert.Equal(t, []string{
+		"ALTER TABLE `app`.`users` MODIFY COLUMN `email` VARCHAR(200) COLLATE utf8mb4_bin NOT NULL DEFAULT 'it''s' COMMENT 'login'",
+		"ALTER TABLE `app`.`users` MODIFY COLUMN `org_id` int unsigned NULL DEFAULT 0 AUTO_INCREMENT",
+		"-- plan is a generated column: restate its expression or this drops it\n" + "ALTER TABLE `app`.`users` MODIFY COLUMN `plan` varchar(255) NOT NULL DEFAULT 'free'",
+	}, up)
+	assert.Equal(t, []string{
+		"-- plan is a generated column: restate its expression or this drops it\n" + "ALTER TABLE `app`.`users` MODIFY COLUMN `plan` varchar(255) NULL",
+		"ALTER TABLE `app`.`users` MODIFY COLUMN `org_id` int unsigned NOT NULL DEFAULT 0 AUTO_INCREMENT",
+		"ALTER TABLE `app`.`users` MODIFY COLUMN `email` varchar(120) COLLATE utf8mb4_bin NOT NULL DEFAULT 'it''s' COMMENT 'login'",
+	}, down)
+	assert.Equal(t, " ON UPDATE CURRENT_TIMESTAMP", mysqlAttrsSQL(alterCode))
+	assert.Equal(t, "CURRENT_TIMESTAMP", liveDefaultSQL(alterCode))
+
+	def, err = (&Model{Value: &alterUser{}}).tableDef("mssql")
+	assert.NoError(t, err)
+	up, _ = def.alterStmts(alterTable)
+	assert.Equal(t, "ALTER TABLE [app].[users] ADD [plan] NVARCHAR(255) NOT NULL DEFAULT 'free'", up[2])
+
+	def, err = (&Model{Value: &alterUser{}}).tableDef("snowflake")
+	assert.NoError(t, err)
+	up, _ = def.alterStmts(alterTable)
+	assert.Equal(t, `ALTER TABLE "APP"."USERS" ALTER COLUMN "EMAIL" SET DATA TYPE VARCHAR(200)`, up[0])
+	assert.Len(t, up, 4)
+}
+
+func TestAlterTableStmts(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	fake.respond = func(string) ([]string, [][]driver.Value) { return nil, nil }
+	up, down, err := conn.AlterTableStmts(&alterUser{})
+	assert.NoError(t, err)
+	assert.Contains(t, up[0], `CREATE TABLE IF NOT EXISTS "app"."users" (`)
+	assert.Equal(t, []string{`DROP TABLE "app"."users"`}, down)
+
+	fake.respond = describeResponder
+	up, down, err = conn.AlterTableStmts(&struct {
+		ID    uuid.UUID `db:"id"`
+		Email string    `db:"email" dasorm:"size=100"`
+		OrgID nulls.Int `db:"org_id"`
+	}{})
+	assert.NoError(t, err)
+	assert.Empty(t, up)
+	assert.Empty(t, down)
+}
@@ -0,0 +1,179 @@
+package dasorm
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultConfigTTL is how long VaultCache keeps configs
+const DefaultConfigTTL = 5 * time.Minute
+
+// VaultCache caches the configs read from vault. it is the default provider.
+var VaultCache = NewCachedProvider(VaultProvider{}, DefaultConfigTTL)
+
+// CachedProvider caches the configs returned by a provider
+type CachedProvider struct {
+	Provider ConfigProvider
+	// TTL is how long a config is kept. zero keeps configs until invalidated.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedConfig
+}
+
+type cachedConfig struct {
+	config  *Config
+	fetched time.Time
+}
+
+// NewCachedProvider caches the configs of provider for ttl
+func NewCachedProvider(provider ConfigProvider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{Provider: provider, TTL: ttl}
+}
+
+// Config returns the cached config of an environment, reading it from the
+// provider if it is missing or expired
+func (c *CachedProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[environment]
+	c.mu.Unlock()
+	if ok && (c.TTL <= 0 || time.Since(entry.fetched) < c.TTL) {
+		return entry.config.clone(), nil
+	}
+	return c.refresh(ctx, environment)
+}
+
+// refresh reads the config of an environment from the provider and caches it
+func (c *CachedProvider) refresh(ctx context.Context, environment string) (*Config, error) {
+	config, err := c.Provider.Config(ctx, environment)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]cachedConfig{}
+	}
+	c.entries[environment] = cachedConfig{config: config.clone(), fetched: time.Now()}
+	c.mu.Unlock()
+	return config, nil
+}
+
+// Invalidate drops the cached config of an environment
+func (c *CachedProvider) Invalidate(environment string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, environment)
+}
+
+// InvalidateAll drops every cached config
+func (c *CachedProvider) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// Watch polls the provider every interval until ctx is done and calls fn
+// with the new config whenever the config of environment changes. the config
+// cached when Watch is called is the starting point.
+func (c *CachedProvider) Watch(ctx context.Context, environment string, interval time.Duration, fn func(*Config)) error {
+	if interval <= 0 {
+		return errors.New("watch interval must be positive")
+	}
+	current, err := c.Config(ctx, environment)
+	if err != nil {
+		return errors.Wrap(err, environment)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			config, err := c.refresh(ctx, environment)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[dasorm] watch %s: %v", environment, err)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(config, current) {
+				current = config
+				fn(config.clone())
+			}
+		}
+	}()
+	return nil
+}
+
+// WatchConfig polls the provider for changes to the config of environment.
+// changes to the pool settings alone are applied to the pool in place; any
+// other change reconnects with the new config, and the old pool is closed
+// once the statements, transactions and rows using it are done. watching
+// stops when ctx is done or the connection is closed.
+func (c *Connection) WatchConfig(ctx context.Context, provider *CachedProvider, environment string, interval time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	c.DB.onClose(cancel)
+	current, err := provider.Config(ctx, environment)
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, environment)
+	}
+	err = provider.Watch(ctx, environment, interval, func(config *Config) {
+		if config.sameConnection(current) {
+			current = config
+			if err := config.poolDefaults(); err != nil {
+				log.Printf("[dasorm] pool settings %s: %v", environment, err)
+				return
+			}
+			config.applyPool(c.DB.pool())
+			return
+		}
+		conn, err := connectConfig(config)
+		if err != nil {
+			log.Printf("[dasorm] reconnect %s: %v", environment, err)
+			return
+		}
+		current = config
+		old, ok := c.DB.swapPool(conn.DB.pool())
+		if !ok {
+			conn.Close()
+			return
+		}
+		closeDrained(old, nil)
+	})
+	if err != nil {
+		cancel()
+	}
+	return err
+}
+
+// sameConnection reports whether two configs differ in their pool settings
+// at most
+func (c *Config) sameConnection(other *Config) bool {
+	a, b := c.clone(), other.clone()
+	for _, config := range []*Config{a, b} {
+		config.MaxOpenConns, config.MaxIdleConns = 0, 0
+		config.ConnMaxLifetime, config.ConnMaxIdleTime = 0, 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// clone returns a deep copy of the config
+func (c *Config) clone() *Config {
+	out := *c
+	if c.Options != nil {
+		out.Options = make(map[string]string, len(c.Options))
+		for k, v := range c.Options {
+			out.Options[k] = v
+		}
+	}
+	return &out
+}
@@ -0,0 +1,137 @@
+package dasorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingProvider returns the current password and counts lookups
+type countingProvider struct {
+	mu       sync.Mutex
+	calls    int
+	password string
+	maxOpen  int
+}
+
+func (p *countingProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	return &Config{Dialect: "postgres", Host: environment, Password: p.password, Options: map[string]string{"sslmode": "require"}, MaxOpenConns: p.maxOpen}, nil
+}
+
+func (p *countingProvider) set(password string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.password = password
+}
+
+func (p *countingProvider) setMaxOpen(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxOpen = n
+}
+
+func (p *countingProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestCachedProvider(t *testing.T) {
+	p := &countingProvider{password: "a"}
+	cache := NewCachedProvider(p, 50*time.Millisecond)
+	ctx := context.Background()
+
+	config, err := cache.Config(ctx, "dev")
+	assert.NoError(t, err)
+	config.Options["sslmode"] = "disable"
+	config, _ = cache.Config(ctx, "dev")
+	assert.Equal(t, "require", config.Options["sslmode"], "cached configs should be copies")
+	assert.Equal(t, 1, p.count())
+
+	cache.Invalidate("dev")
+	cache.Config(ctx, "dev")
+	assert.Equal(t, 2, p.count())
+
+	time.Sleep(60 * time.Millisecond)
+	cache.Config(ctx, "dev")
+	assert.Equal(t, 3, p.count())
+
+	cache.InvalidateAll()
+	cache.Config(ctx, "dev")
+	assert.Equal(t, 4, p.count())
+}
+
+func TestCachedProviderWatch(t *testing.T) {
+	p := &countingProvider{password: "a"}
+	cache := NewCachedProvider(p, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan *Config, 1)
+	err := cache.Watch(ctx, "dev", 10*time.Millisecond, func(config *Config) { changes <- config })
+	assert.NoError(t, err)
+	p.set("b")
+	select {
+	case config := <-changes:
+		assert.Equal(t, "b", config.Password)
+	case <-time.After(time.Second):
+		t.Fatal("no change reported")
+	}
+	cached, _ := cache.Config(ctx, "dev")
+	assert.Equal(t, "b", cached.Password)
+
+	assert.Error(t, cache.Watch(ctx, "dev", 0, func(*Config) {}))
+}
+
+func TestWatchConfig(t *testing.T) {
+	p := &countingProvider{password: "a"}
+	cache := NewCachedProvider(p, 0)
+	var (
+		mu        sync.Mutex
+		passwords []string
+	)
+	connectConfig = func(config *Config) (*Connection, error) {
+		mu.Lock()
+		passwords = append(passwords, config.Password)
+		mu.Unlock()
+		conn, _ := newFakeConnection(t, "postgres")
+		return conn, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+
+	conn, fake := newFakeConnection(t, "postgres")
+	first := conn.DB.pool()
+	assert.NoError(t, conn.WatchConfig(context.Background(), cache, "dev", 10*time.Millisecond))
+
+	// pool settings are applied in place
+	p.setMaxOpen(7)
+	assert.Eventually(t, func() bool { return first.Stats().MaxOpenConnections == 7 }, time.Second, 10*time.Millisecond)
+	assert.True(t, conn.DB.pool() == first)
+
+	// other changes reconnect, the old pool is closed once it drains
+	tx, err := conn.Begin()
+	assert.NoError(t, err)
+	p.set("b")
+	assert.Eventually(t, func() bool { return conn.DB.pool() != first }, time.Second, 10*time.Millisecond)
+	time.Sleep(3 * drainInterval)
+	_, err = tx.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Equal(t, []string{"SELECT 1"}, fake.Statements())
+	assert.Eventually(t, func() bool { return first.Ping() != nil }, time.Second, 10*time.Millisecond)
+	conn.Close()
+
+	time.Sleep(20 * time.Millisecond)
+	calls := p.count()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, calls, p.count(), "closing the connection should stop the watch")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"b"}, passwords)
+}
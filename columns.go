@@ -3,6 +3,8 @@ package dasorm
 import (
 	"fmt"
 	"strings"
+
+	"github.com/estenssoros/dasorm/nulls"
 )
 
 var (
@@ -18,6 +20,21 @@ type Column struct {
 	Name     string
 	DataType string
 	Length   int
+	// the attributes below are only set by DescribeTable
+	Nullable  bool
+	Default   nulls.String
+	Precision int
+	Scale     int
+	// Identity is set for identity and auto increment columns and Generated
+	// for computed ones. the database fills both in on insert.
+	Identity  bool
+	Generated bool
+	// ColumnType, Extra, Comment and Collation are only set on mysql, which
+	// restates them when it modifies a column
+	ColumnType string
+	Extra      string
+	Comment    string
+	Collation  string
 }
 
 // UpperName converts column to uppercase
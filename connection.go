@@ -3,8 +3,12 @@ package dasorm
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"database/sql/driver"
+	"log"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -14,13 +18,150 @@ import (
 // DB waraps sqlx.DB
 type DB struct {
 	*sqlx.DB
-	Debug bool
+	Debug   bool
+	Logger  Logger
+	SlowLog *SlowQueryLog
+	Hooks   []Hook
+	// StatementTimeout limits how long statements may run. see
+	// Connection.SetStatementTimeout.
+	StatementTimeout time.Duration
+	dialect          string
+	// qualifier prefixes the table names of generated sql with the schema
+	// or database of a tenant, see Connection.WithSchema
+	qualifier string
+
+	// mu guards the embedded pool, which is replaced when credentials rotate
+	mu       sync.RWMutex
+	closed   bool
+	closers  []func()
+	replicas *replicaSet
+	health   *healthMonitor
+	// tenants are the pools of tenants by key, nil for tenants sharing the
+	// primary's, and tenantOrder their keys, least recently used first
+	tenants     map[string]*sqlx.DB
+	tenantOrder []string
+
+	// source returns the config to reconnect with, if the db knows it
+	source func(ctx context.Context) (*Config, error)
+
+	// err fails every statement of a db whose pool could not be opened,
+	// see failed
+	err error
+}
+
+// pool returns the current connection pool
+func (db *DB) pool() *sqlx.DB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.DB
+}
+
+// swapPool replaces the connection pool and returns the old one. it reports
+// false if the db has been closed, in which case the pool is left unchanged.
+func (db *DB) swapPool(pool *sqlx.DB) (*sqlx.DB, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, false
+	}
+	old := db.DB
+	db.DB = pool
+	return old, true
+}
+
+// failed returns a db with the settings of db that fails every statement
+// with err. its pool is closed so nothing can reach a server through it.
+func (db *DB) failed(err error) *DB {
+	pool := sql.OpenDB(failedConnector{err})
+	pool.Close()
+	out := db.withPool(sqlx.NewDb(pool, db.pool().DriverName()))
+	out.err = err
+	return out
+}
+
+// failedConnector is a driver opening no connections
+type failedConnector struct{ err error }
+
+func (c failedConnector) Connect(context.Context) (driver.Conn, error) { return nil, c.err }
+func (c failedConnector) Driver() driver.Driver                        { return c }
+func (c failedConnector) Open(string) (driver.Conn, error)             { return nil, c.err }
+
+// drainTimeout is how long a replaced pool is kept open for the statements,
+// transactions and rows still using it, and drainInterval how often it is
+// checked
+var (
+	drainTimeout  = time.Minute
+	drainInterval = 100 * time.Millisecond
+)
+
+// closeDrained closes a pool that is no longer handed out once none of its
+// connections are in use, or after drainTimeout, and then calls done if it
+// is not nil
+func closeDrained(pool *sqlx.DB, done func()) {
+	deadline, interval := time.Now().Add(drainTimeout), drainInterval
+	go func() {
+		for {
+			// wait at least once so a caller that was just handed the
+			// pool gets to take a connection
+			time.Sleep(interval)
+			if pool.Stats().InUse == 0 || time.Now().After(deadline) {
+				break
+			}
+		}
+		pool.Close()
+		if done != nil {
+			done()
+		}
+	}()
+}
+
+// onClose registers fn to be run once the db is closed. fn runs right away
+// if the db is already closed.
+func (db *DB) onClose(fn func()) {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		fn()
+		return
+	}
+	db.closers = append(db.closers, fn)
+	db.mu.Unlock()
+}
+
+// Close closes the connection pool and stops any background work tied to it
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	closers := db.closers
+	db.closers = nil
+	tenants := db.tenants
+	db.tenants, db.tenantOrder = nil, nil
+	db.mu.Unlock()
+	err := db.DB.Close()
+	for _, pool := range tenants {
+		if pool != nil {
+			pool.Close()
+		}
+	}
+	for _, fn := range closers {
+		fn()
+	}
+	return err
 }
 
 // Connection holds a pointer to the database connection
 type Connection struct {
 	DB      *DB
-	Dialect dialect
+	Dialect Dialect
+
+	// onPrimary sends reads to the primary even if there are replicas
+	onPrimary bool
+	// tenant is the schema and database set by WithSchema and WithDatabase
+	tenant tenant
 }
 
 // Close wraps db.close
@@ -33,159 +174,261 @@ func (c *Connection) Debug(d bool) {
 	c.DB.Debug = d
 }
 
+// SetLogger sets the logger that receives every executed statement
+func (c *Connection) SetLogger(l Logger) {
+	c.DB.Logger = l
+}
+
 // Config holds database information
 type Config struct {
 	Dialect  string `vault:"dialect"`
 	Database string `vault:"database"`
 	Host     string `vault:"host"`
 	Port     string `vault:"port"`
-	User     string `vault:"user"`
-	Password string `vault:"password"`
+	User     string `vault:"user,optional"`
+	Password string `vault:"password,optional"`
+
+	// Options holds dialect specific driver options such as sslmode, tls,
+	// timezone, charset, application_name or the snowflake warehouse, role
+	// and schema
+	Options map[string]string `vault:"options,optional"`
+
+	// pool settings. zero values fall back to the DASORM_* environment
+	// variables and then to the database/sql defaults.
+	MaxOpenConns    int           `vault:"max_open_conns,optional"`
+	MaxIdleConns    int           `vault:"max_idle_conns,optional"`
+	ConnMaxLifetime time.Duration `vault:"conn_max_lifetime,optional"`
+	ConnMaxIdleTime time.Duration `vault:"conn_max_idle_time,optional"`
+}
+
+// pool environment variables
+const (
+	envMaxOpenConns    = "DASORM_MAX_OPEN_CONNS"
+	envMaxIdleConns    = "DASORM_MAX_IDLE_CONNS"
+	envConnMaxLifetime = "DASORM_CONN_MAX_LIFETIME"
+	envConnMaxIdleTime = "DASORM_CONN_MAX_IDLE_TIME"
+)
+
+// poolDefaults fills unset pool settings from the environment
+func (c *Config) poolDefaults() error {
+	if c.MaxOpenConns == 0 {
+		if v := os.Getenv(envMaxOpenConns); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.Wrap(err, envMaxOpenConns)
+			}
+			c.MaxOpenConns = n
+		}
+	}
+	if c.MaxIdleConns == 0 {
+		if v := os.Getenv(envMaxIdleConns); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.Wrap(err, envMaxIdleConns)
+			}
+			c.MaxIdleConns = n
+		}
+	}
+	if c.ConnMaxLifetime == 0 {
+		if v := os.Getenv(envConnMaxLifetime); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return errors.Wrap(err, envConnMaxLifetime)
+			}
+			c.ConnMaxLifetime = d
+		}
+	}
+	if c.ConnMaxIdleTime == 0 {
+		if v := os.Getenv(envConnMaxIdleTime); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return errors.Wrap(err, envConnMaxIdleTime)
+			}
+			c.ConnMaxIdleTime = d
+		}
+	}
+	return nil
 }
 
-// ConnectDBConfig connects to db given config
+// applyPool applies the pool settings of the config to db
+func (c *Config) applyPool(db *sqlx.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// ConnectDBConfig connects to db given config. see RegisterDialect for the
+// dialects it knows.
 func ConnectDBConfig(config *Config) (*Connection, error) {
-	switch config.Dialect {
-	case "mysql":
-		return connectMySQL(config)
-	case "postgres":
-		return connectPostgres(config)
-	case "microsoft_sql":
-		return connectMSSQL(config)
-	case "snowflake":
-		return connectSnowflake(config)
-	default:
-		return nil, fmt.Errorf("%s dialect not recognized", config.Dialect)
-	}
-}
-
-// connectDBHandler reads creds from service and provides databse connection
-func connectDBHandler(server string) (*Connection, error) {
-	config, err := GetConfigVault(server)
+	d, err := lookupDialect(config.Dialect)
 	if err != nil {
-		return nil, errors.Wrap(err, server)
+		return nil, err
+	}
+	if d.Connect == nil {
+		return nil, errors.Errorf("%s dialect cannot connect", d.name)
 	}
-	return ConnectDBConfig(config)
+	if err := config.validateOptions(); err != nil {
+		return nil, err
+	}
+	if err := config.poolDefaults(); err != nil {
+		return nil, err
+	}
+	timeout, err := config.statementTimeout()
+	if err != nil {
+		return nil, err
+	}
+	db, err := d.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	config.applyPool(db)
+	return &Connection{
+		DB: &DB{
+			DB:               db,
+			dialect:          d.Dialect.Name(),
+			StatementTimeout: timeout,
+			source: func(context.Context) (*Config, error) {
+				return config, nil
+			},
+		},
+		Dialect: d.Dialect,
+	}, nil
+}
+
+// Stats returns the connection pool statistics
+func (c *Connection) Stats() sql.DBStats {
+	return c.DB.pool().Stats()
 }
 
 // Ping wraps the db ping method
 func (c *Connection) Ping() error {
-	return c.DB.Ping()
+	return c.DB.pool().Ping()
 }
 
-// MockDB takes a sql connection and dialect name, and returns a mock connection for testing
+// MockDB takes a sql connection and dialect name, and returns a mock connection for testing.
+// an unregistered dialect falls back to mysql, see NewMockDB.
 func MockDB(db *sql.DB, dialectName string) *Connection {
-	var Dialect dialect
-	switch dialectName {
-	case "mysql":
-		Dialect = &mysql{}
-	case "postgres":
-		Dialect = &postgres{}
-	case "mssql":
-		Dialect = &mssql{}
-	case "snowflake":
-		Dialect = &snowflake{}
-	default:
-		Dialect = &mysql{}
+	conn, err := NewMockDB(db, dialectName)
+	if err != nil {
+		log.Printf("[dasorm] %v, using mysql", err)
+		conn, _ = NewMockDB(db, "mysql")
+	}
+	return conn
+}
+
+// NewMockDB is MockDB returning an error for an unregistered dialect
+func NewMockDB(db *sql.DB, dialectName string) (*Connection, error) {
+	d, err := lookupDialect(dialectName)
+	if err != nil {
+		return nil, err
 	}
 	mockDB := sqlx.NewDb(db, "sqlmock")
 	return &Connection{
-		DB:      &DB{mockDB, false},
-		Dialect: Dialect,
-	}
+		DB:      &DB{DB: mockDB, dialect: d.Dialect.Name()},
+		Dialect: d.Dialect,
+	}, nil
 }
 
 // ConnectDB connects to a database environment
 func ConnectDB(server string) (*Connection, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	ch := make(chan struct {
-		conn *Connection
-		err  error
-	})
-
-	go func() {
-		conn, err := connectDBHandler(server)
-		ch <- struct {
-			conn *Connection
-			err  error
-		}{conn, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case pack := <-ch:
-		if pack.err != nil {
-			return nil, pack.err
-		}
-		return pack.conn, nil
-	}
+	return ConnectDBTimeout(server, 5)
 }
 
 // ConnectDBTimeout attempts to connect with a custom timeout
 func ConnectDBTimeout(server string, timeout int) (*Connection, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
-	ch := make(chan struct {
-		conn *Connection
-		err  error
-	})
-
-	go func() {
-		conn, err := connectDBHandler(server)
-		ch <- struct {
-			conn *Connection
-			err  error
-		}{conn, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case pack := <-ch:
-		if pack.err != nil {
-			return nil, pack.err
-		}
-		return pack.conn, nil
-	}
+	return ConnectDBProvider(ctx, DefaultProvider, server)
 }
 
 // Query wraps the query method
 func (c *Connection) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	return c.DB.Query(query, args...)
+	return c.reader().query(context.Background(), query, args...)
 }
 
 // QueryContext wraps the QueryContext method
 func (c *Connection) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	return c.DB.QueryContext(ctx, query, args...)
+	return c.reader().query(ctx, query, args...)
 }
 
 // QueryRowContext wraps the QueryRowContext method
 func (c *Connection) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	return c.DB.QueryRowContext(ctx, query, args...)
+	return c.reader().queryRow(ctx, query, args...)
 }
 
 // QueryRow wraps the QueryRowContext method
 func (c *Connection) QueryRow(query string, args ...interface{}) *sql.Row {
-	return c.DB.QueryRow(query, args...)
+	return c.reader().queryRow(context.Background(), query, args...)
 }
 
 // ExecContext wraps the ExecContext method
 func (c *Connection) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	return c.DB.ExecContext(ctx, query, args...)
+	return c.writer().exec(ctx, query, args...)
 }
 
 // Exec wraps the ExecContext method
 func (c *Connection) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return c.DB.Exec(query, args...)
+	return c.writer().exec(context.Background(), query, args...)
+}
+
+// Session is a session or transaction taken from a connection, such as a
+// *sql.Conn or *sql.Tx
+type Session interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ExecOn runs a statement on a session of the connection, reporting it to
+// the hooks and loggers like the statements of the connection. the statement
+// timeout does not apply.
+func (c *Connection) ExecOn(ctx context.Context, s Session, query string, args ...interface{}) (sql.Result, error) {
+	db := c.writer()
+	ctx = db.withOperation(ctx, OpExec, "")
+	return db.run(ctx, query, args, func(ctx context.Context) (sql.Result, int64, error) {
+		res, err := s.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+		rows, _ := res.RowsAffected()
+		return res, rows, nil
+	})
+}
+
+// QueryOn runs a statement returning rows on a session of the connection,
+// see ExecOn
+func (c *Connection) QueryOn(ctx context.Context, s Session, query string, args ...interface{}) (*sql.Rows, error) {
+	db := c.writer()
+	ctx = db.withOperation(ctx, OpQuery, "")
+	var rows *sql.Rows
+	_, err := db.run(ctx, query, args, func(ctx context.Context) (sql.Result, int64, error) {
+		var err error
+		rows, err = s.QueryContext(ctx, query, args...)
+		return nil, 0, err
+	})
+	return rows, err
 }
 
 // WriteTuples writes tuples to database
 func (c *Connection) WriteTuples(insertStmt string, tuples []string) error {
-	if _, err := c.DB.Exec(insertStmt + strings.Join(tuples, ",")); err != nil {
+	db := c.writer()
+	ctx := db.withOperation(context.Background(), OpWriteTuples, "")
+	r := tupleRedactor(insertStmt, tuples)
+	ctx = withRedactor(ctx, r)
+	if _, err := db.exec(ctx, insertStmt+strings.Join(tuples, ",")); err != nil {
 		for _, t := range tuples {
-			if _, err := c.DB.Exec(insertStmt + t); err != nil {
+			if _, err := db.exec(ctx, insertStmt+t); err != nil {
+				if r != nil {
+					t = r.Statement(t)
+				}
 				return errors.Wrap(err, insertStmt+t)
 			}
 		}
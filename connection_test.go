@@ -0,0 +1,32 @@
+package dasorm
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigPoolDefaults(t *testing.T) {
+	os.Setenv(envMaxOpenConns, "20")
+	os.Setenv(envConnMaxLifetime, "1h")
+	defer os.Unsetenv(envMaxOpenConns)
+	defer os.Unsetenv(envConnMaxLifetime)
+
+	config := &Config{MaxOpenConns: 5}
+	assert.NoError(t, config.poolDefaults())
+	assert.Equal(t, 5, config.MaxOpenConns)
+	assert.Equal(t, time.Hour, config.ConnMaxLifetime)
+
+	os.Setenv(envMaxIdleConns, "asdf")
+	defer os.Unsetenv(envMaxIdleConns)
+	assert.Error(t, (&Config{}).poolDefaults())
+}
+
+func TestConfigApplyPool(t *testing.T) {
+	conn, _ := newFakeConnection(t, "mysql")
+	config := &Config{MaxOpenConns: 3}
+	config.applyPool(conn.DB.DB)
+	assert.Equal(t, 3, conn.Stats().MaxOpenConnections)
+}
@@ -0,0 +1,421 @@
+package dasorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/estenssoros/dasorm/nulls"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// defaultVarcharSize is the length of string columns without a size option
+const defaultVarcharSize = 255
+
+// kinds of the columns a field can map to
+const (
+	stringColumn = iota
+	smallintColumn
+	intColumn
+	bigintColumn
+	realColumn
+	doubleColumn
+	boolColumn
+	timeColumn
+	uuidColumn
+)
+
+// columnTypes are the names of the column kinds in a dialect. varchar is a
+// format taking the length.
+type columnTypes struct {
+	varchar   string
+	smallint  string
+	integer   string
+	bigint    string
+	real      string
+	double    string
+	boolean   string
+	timestamp string
+	uuid      string
+}
+
+var (
+	mysqlTypes     = columnTypes{"VARCHAR(%d)", "SMALLINT", "INT", "BIGINT", "FLOAT", "DOUBLE", "BOOLEAN", "DATETIME(6)", "CHAR(36)"}
+	postgresTypes  = columnTypes{"VARCHAR(%d)", "SMALLINT", "INTEGER", "BIGINT", "REAL", "DOUBLE PRECISION", "BOOLEAN", "TIMESTAMP", "UUID"}
+	mssqlTypes     = columnTypes{"NVARCHAR(%d)", "SMALLINT", "INT", "BIGINT", "REAL", "FLOAT", "BIT", "DATETIME2", "UNIQUEIDENTIFIER"}
+	snowflakeTypes = columnTypes{"VARCHAR(%d)", "SMALLINT", "INTEGER", "BIGINT", "FLOAT", "FLOAT", "BOOLEAN", "TIMESTAMP_NTZ", "VARCHAR(36)"}
+	// ansiTypes are used for dialects without a mapping of their own
+	ansiTypes = columnTypes{"VARCHAR(%d)", "SMALLINT", "INTEGER", "BIGINT", "REAL", "DOUBLE PRECISION", "BOOLEAN", "TIMESTAMP", "CHAR(36)"}
+)
+
+// mssqlMaxNVarchar is the longest nvarchar with a length, longer ones are MAX
+const mssqlMaxNVarchar = 4000
+
+func typesOf(dialect string) columnTypes {
+	switch dialect {
+	case "mysql":
+		return mysqlTypes
+	case "postgres":
+		return postgresTypes
+	case "mssql":
+		return mssqlTypes
+	case "snowflake":
+		return snowflakeTypes
+	default:
+		return ansiTypes
+	}
+}
+
+func (t columnTypes) name(kind, length int) string {
+	switch kind {
+	case stringColumn:
+		if t == mssqlTypes && length > mssqlMaxNVarchar {
+			return "NVARCHAR(MAX)"
+		}
+		return fmt.Sprintf(t.varchar, length)
+	case smallintColumn:
+		return t.smallint
+	case intColumn:
+		return t.integer
+	case bigintColumn:
+		return t.bigint
+	case realColumn:
+		return t.real
+	case doubleColumn:
+		return t.double
+	case boolColumn:
+		return t.boolean
+	case timeColumn:
+		return t.timestamp
+	default:
+		return t.uuid
+	}
+}
+
+// fieldColumn is the column a struct field maps to
+type fieldColumn struct {
+	name     string
+	goType   reflect.Type
+	kind     int
+	length   int
+	dataType string
+	// custom is set when the type comes from a type option
+	custom   bool
+	nullable bool
+	// def is the raw sql of the default, if any
+	def     string
+	primary bool
+	unique  bool
+}
+
+// tableIndex is an index or a named unique constraint over fields
+type tableIndex struct {
+	name    string
+	columns []string
+	unique  bool
+}
+
+// tableDef is the table a model maps to
+type tableDef struct {
+	name    string
+	dialect string
+	columns []*fieldColumn
+	indexes []*tableIndex
+}
+
+// fieldKind returns the column kind of a field type and whether it is one of
+// the nullable types of the nulls package
+func fieldKind(t reflect.Type) (int, bool, error) {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return timeColumn, false, nil
+	case reflect.TypeOf(uuid.UUID{}):
+		return uuidColumn, false, nil
+	case reflect.TypeOf(nulls.String{}):
+		return stringColumn, true, nil
+	case reflect.TypeOf(nulls.Int{}):
+		return bigintColumn, true, nil
+	case reflect.TypeOf(nulls.Float64{}):
+		return doubleColumn, true, nil
+	case reflect.TypeOf(nulls.Bool{}):
+		return boolColumn, true, nil
+	case reflect.TypeOf(nulls.Time{}):
+		return timeColumn, true, nil
+	case reflect.TypeOf(nulls.UUID{}):
+		return uuidColumn, true, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return stringColumn, false, nil
+	case reflect.Int8, reflect.Int16:
+		return smallintColumn, false, nil
+	case reflect.Int32:
+		return intColumn, false, nil
+	case reflect.Int, reflect.Int64:
+		return bigintColumn, false, nil
+	case reflect.Float32:
+		return realColumn, false, nil
+	case reflect.Float64:
+		return doubleColumn, false, nil
+	case reflect.Bool:
+		return boolColumn, false, nil
+	}
+	return 0, false, errors.Errorf("unsupported field type %v", t)
+}
+
+// structType returns the struct type of a model value
+func structType(v interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, errors.New("must pass struct")
+	}
+	return t, nil
+}
+
+// tableDef reads the table of the model from the `db`, `dasorm` and
+// `dasorm_key` tags of its fields
+func (m *Model) tableDef(dialect string) (*tableDef, error) {
+	t, err := structType(m.Value)
+	if err != nil {
+		return nil, err
+	}
+	def := &tableDef{name: m.TableName(), dialect: dialect}
+	types := typesOf(dialect)
+	indexes := map[string]*tableIndex{}
+	addIndex := func(name, column string, unique bool) {
+		idx, ok := indexes[name]
+		if !ok {
+			idx = &tableIndex{name: name, unique: unique}
+			indexes[name] = idx
+			def.indexes = append(def.indexes, idx)
+		}
+		idx.columns = append(idx.columns, column)
+	}
+	var id *fieldColumn
+	keyed := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("db")
+		if name == "" || name == "-" {
+			continue
+		}
+		kind, nullable, err := fieldKind(f.Type)
+		if err != nil {
+			return nil, errors.Wrap(err, f.Name)
+		}
+		col := &fieldColumn{name: name, goType: f.Type, kind: kind, nullable: nullable}
+		if kind == stringColumn {
+			col.length = defaultVarcharSize
+			if size, ok := tagOption(f, "size"); ok {
+				if _, err := fmt.Sscanf(size, "%d", &col.length); err != nil || col.length <= 0 {
+					return nil, errors.Errorf("%s: invalid size %q", f.Name, size)
+				}
+			}
+		}
+		col.dataType = types.name(kind, col.length)
+		if typ, ok := tagOption(f, "type"); ok {
+			col.dataType, col.custom = typ, true
+		}
+		if d, ok := tagOption(f, "default"); ok {
+			col.def = d
+		}
+		if f.Tag.Get("dasorm_key") == "primary" {
+			col.primary, keyed = true, true
+		}
+		if f.Name == "ID" {
+			id = col
+		}
+		if name, ok := tagOption(f, "unique"); ok {
+			addIndex(name, col.name, true)
+		} else if hasTagOption(f, "unique") {
+			col.unique = true
+		}
+		if name, ok := tagOption(f, "index"); ok {
+			addIndex(name, col.name, false)
+		} else if hasTagOption(f, "index") {
+			addIndex(baseName(def.name)+"_"+col.name+"_idx", col.name, false)
+		}
+		def.columns = append(def.columns, col)
+	}
+	if !keyed && id != nil {
+		id.primary = true
+	}
+	for _, col := range def.columns {
+		if col.primary {
+			col.nullable = false
+		}
+	}
+	return def, nil
+}
+
+// baseName strips the schema or database from a table name
+func baseName(table string) string {
+	return table[strings.LastIndex(table, ".")+1:]
+}
+
+// quoteIdent quotes an identifier, and each part of a qualified one, for
+// the dialect. snowflake names are upper cased so that they match unquoted
+// names in queries.
+func quoteIdent(dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		switch dialect {
+		case "mysql":
+			parts[i] = "`" + strings.Replace(p, "`", "``", -1) + "`"
+		case "mssql":
+			parts[i] = "[" + strings.Replace(p, "]", "]]", -1) + "]"
+		case "snowflake":
+			p = strings.ToUpper(p)
+			fallthrough
+		default:
+			parts[i] = `"` + strings.Replace(p, `"`, `""`, -1) + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (d *tableDef) quote(name string) string {
+	return quoteIdent(d.dialect, name)
+}
+
+func (d *tableDef) quoteAll(names []string) string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = d.quote(n)
+	}
+	return strings.Join(out, ", ")
+}
+
+// columnSQL is the definition of a column in a CREATE or ALTER TABLE
+func (d *tableDef) columnSQL(col *fieldColumn) string {
+	s := d.quote(col.name) + " " + col.dataType
+	if !col.nullable {
+		s += " NOT NULL"
+	}
+	if col.def != "" {
+		s += " DEFAULT " + d.defaultSQL(col)
+	}
+	if col.unique {
+		s += " UNIQUE"
+	}
+	return s
+}
+
+// defaultSQL returns the default of a column. booleans are bits on mssql.
+func (d *tableDef) defaultSQL(col *fieldColumn) string {
+	if d.dialect == "mssql" && col.kind == boolColumn {
+		switch strings.ToLower(col.def) {
+		case "true":
+			return "1"
+		case "false":
+			return "0"
+		}
+	}
+	return col.def
+}
+
+// createIndexSQL is a CREATE INDEX statement. mysql and mssql have no
+// IF NOT EXISTS for indexes.
+func (d *tableDef) createIndexSQL(idx *tableIndex) string {
+	create := "CREATE INDEX"
+	if idx.unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	if !d.inlineIndexes() {
+		create += " IF NOT EXISTS"
+	}
+	return fmt.Sprintf("%s %s ON %s (%s)", create, d.quote(idx.name), d.quote(d.name), d.quoteAll(idx.columns))
+}
+
+// inlineIndexes reports whether indexes are declared in CREATE TABLE
+func (d *tableDef) inlineIndexes() bool {
+	return d.dialect == "mysql" || d.dialect == "mssql"
+}
+
+// createStmts returns the CREATE TABLE statement of the table followed by
+// the statements creating its indexes. snowflake has no indexes so they are
+// left out there.
+func (d *tableDef) createStmts() []string {
+	lines := []string{}
+	primary := []string{}
+	for _, col := range d.columns {
+		lines = append(lines, d.columnSQL(col))
+		if col.primary {
+			primary = append(primary, col.name)
+		}
+	}
+	if len(primary) > 0 {
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", d.quoteAll(primary)))
+	}
+	after := []string{}
+	for _, idx := range d.indexes {
+		switch {
+		case idx.unique:
+			lines = append(lines, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", d.quote(idx.name), d.quoteAll(idx.columns)))
+		case d.dialect == "snowflake":
+		case d.inlineIndexes():
+			lines = append(lines, fmt.Sprintf("INDEX %s (%s)", d.quote(idx.name), d.quoteAll(idx.columns)))
+		default:
+			after = append(after, d.createIndexSQL(idx))
+		}
+	}
+	body := fmt.Sprintf("%s (\n  %s\n)", d.quote(d.name), strings.Join(lines, ",\n  "))
+	create := "CREATE TABLE IF NOT EXISTS " + body
+	if d.dialect == "mssql" {
+		create = fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s", strings.Replace(d.quote(d.name), "'", "''", -1), body)
+	}
+	return append([]string{create}, after...)
+}
+
+// createTableStmts returns the statements creating the table of a model
+func createTableStmts(m *Model, dialect string) ([]string, error) {
+	d, err := lookupDialect(dialect)
+	if err != nil {
+		return nil, err
+	}
+	def, err := m.tableDef(d.Dialect.Name())
+	if err != nil {
+		return nil, errors.Wrap(err, "create table")
+	}
+	return def.createStmts(), nil
+}
+
+// CreateTableStmt returns the ddl creating the table of a model on a
+// dialect, statements separated by semicolons. columns come from the `db`
+// tags with types mapped for the database and are NOT NULL unless they are
+// of a nulls type. the primary key is the fields tagged
+// `dasorm_key:"primary"`, or else ID. the `dasorm` tag takes the options
+//
+//	size=n          length of a string column, 255 by default
+//	type=T          column type, overriding the mapping
+//	default=sql     column default, used as is (it cannot contain commas)
+//	unique          unique column; unique=name adds it to a named constraint
+//	index           indexed column; index=name adds it to a named index
+func CreateTableStmt(model interface{}, dialect string) (string, error) {
+	stmts, err := createTableStmts(&Model{Value: model}, dialect)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(stmts, ";\n") + ";", nil
+}
+
+// CreateTable creates the table of a model if it does not exist
+func (c *Connection) CreateTable(model interface{}) error {
+	def, err := c.tableDef(model)
+	if err != nil {
+		return err
+	}
+	db := c.writer()
+	for _, stmt := range def.createStmts() {
+		if _, err := db.exec(context.Background(), stmt); err != nil {
+			return errors.Wrap(err, "create table")
+		}
+	}
+	return nil
+}
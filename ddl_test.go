@@ -0,0 +1,88 @@
+package dasorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/estenssoros/dasorm/nulls"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type ddlUser struct {
+	ID        uuid.UUID    `db:"id"`
+	Email     string       `db:"email" dasorm:"size=120,unique"`
+	Name      nulls.String `db:"name"`
+	Age       int32        `db:"age" dasorm:"default=0"`
+	Active    bool         `db:"active" dasorm:"default=true,index"`
+	Score     float64      `db:"score"`
+	Org       int          `db:"org" dasorm:"index=ddl_user_org"`
+	Team      int          `db:"team" dasorm:"index=ddl_user_org"`
+	CreatedAt time.Time    `db:"created_at"`
+	Ignored   string
+}
+
+func (ddlUser) TableName() string { return "users" }
+
+type ddlKeyed struct {
+	ID   int    `db:"id"`
+	Code string `db:"code" dasorm_key:"primary" dasorm:"type=CHAR(3)"`
+}
+
+func TestCreateTableStmt(t *testing.T) {
+	stmt, err := CreateTableStmt(&ddlUser{}, "postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "users" (
+  "id" UUID NOT NULL,
+  "email" VARCHAR(120) NOT NULL UNIQUE,
+  "name" VARCHAR(255),
+  "age" INTEGER NOT NULL DEFAULT 0,
+  "active" BOOLEAN NOT NULL DEFAULT true,
+  "score" DOUBLE PRECISION NOT NULL,
+  "org" BIGINT NOT NULL,
+  "team" BIGINT NOT NULL,
+  "created_at" TIMESTAMP NOT NULL,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "users_active_idx" ON "users" ("active");
+CREATE INDEX IF NOT EXISTS "ddl_user_org" ON "users" ("org", "team");`, stmt)
+
+	stmt, err = CreateTableStmt([]ddlUser{}, "mysql")
+	assert.NoError(t, err)
+	assert.Contains(t, stmt, "CREATE TABLE IF NOT EXISTS `users` (\n  `id` CHAR(36) NOT NULL,")
+	assert.Contains(t, stmt, "`created_at` DATETIME(6) NOT NULL")
+	assert.Contains(t, stmt, "INDEX `ddl_user_org` (`org`, `team`)\n);")
+
+	stmt, err = CreateTableStmt(&ddlUser{}, "sqlserver")
+	assert.NoError(t, err)
+	assert.Contains(t, stmt, "IF OBJECT_ID(N'[users]', N'U') IS NULL CREATE TABLE [users] (")
+	assert.Contains(t, stmt, "[active] BIT NOT NULL DEFAULT 1")
+	assert.Contains(t, stmt, "[name] NVARCHAR(255),")
+
+	stmt, err = CreateTableStmt(&ddlUser{}, "snowflake")
+	assert.NoError(t, err)
+	assert.Contains(t, stmt, `"CREATED_AT" TIMESTAMP_NTZ NOT NULL`)
+	assert.NotContains(t, stmt, "INDEX")
+
+	stmt, err = CreateTableStmt(&ddlKeyed{}, "postgres")
+	assert.NoError(t, err)
+	assert.Contains(t, stmt, `"code" CHAR(3) NOT NULL,`)
+	assert.Contains(t, stmt, `PRIMARY KEY ("code")`)
+
+	_, err = CreateTableStmt(&ddlUser{}, "oracle")
+	assert.EqualError(t, err, "oracle dialect not recognized")
+	_, err = CreateTableStmt(&struct {
+		C []string `db:"c"`
+	}{}, "postgres")
+	assert.EqualError(t, err, "create table: C: unsupported field type []string")
+}
+
+func TestCreateTable(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	tenant, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+	assert.NoError(t, tenant.CreateTable(&ddlKeyed{}))
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS \"acme\".\"ddlKeyed\" (\n  \"id\" BIGINT NOT NULL,\n  \"code\" CHAR(3) NOT NULL,\n  PRIMARY KEY (\"code\")\n)",
+	}, fake.Statements())
+}
@@ -1,25 +1,26 @@
 package dasorm
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/fatih/color"
 	interpol "github.com/imkira/go-interpol"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 )
 
-func printSQL(s string) {
-	breaks := strings.Split(s, "\n")
-	for i, b := range breaks {
-		breaks[i] = strings.TrimSpace(b)
-	}
-	color.Green(strings.Join(breaks, " "))
-}
-
-type dialect interface {
+// Dialect generates and runs the sql of one kind of database. a dialect is
+// shared by every connection using it and must be safe for concurrent use.
+// registered dialects run their statements with DB.RunExec, RunGet and
+// RunSelect so they are timed out, redacted and reported to the hooks and
+// loggers like those of the built in dialects.
+type Dialect interface {
 	Name() string
 	TranslateSQL(string) string
 	Create(*DB, *Model) error
@@ -35,28 +36,168 @@ type dialect interface {
 	SQLView(*DB, *Model, map[string]string) error
 }
 
-func craftCreate(model *Model) string {
+// Connector opens the connections of a registered dialect
+type Connector struct {
+	Dialect Dialect
+	// Connect opens and pings a pool for a config. a dialect without one can
+	// only be used with MockDB.
+	Connect func(config *Config) (*sqlx.DB, error)
+	// Options lists the Config.Options keys the dialect understands. nil
+	// accepts any option.
+	Options []string
+}
+
+// registeredDialect is a connector and the name it was registered under
+type registeredDialect struct {
+	Connector
+	name string
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]*registeredDialect{}
+)
+
+func init() {
+	for _, d := range []struct {
+		name      string
+		aliases   []string
+		connector Connector
+	}{
+		{"mysql", nil, Connector{
+			Dialect: &mysql{},
+			Connect: connectMySQL,
+			Options: []string{"tls", "charset", "collation", "timezone", "timeout", "read_timeout", "write_timeout", "statement_timeout"},
+		}},
+		{"postgres", []string{"postgresql"}, Connector{
+			Dialect: &postgres{},
+			Connect: connectPostgres,
+			Options: []string{"sslmode", "sslrootcert", "sslcert", "sslkey", "timezone", "application_name", "connect_timeout", "search_path", "statement_timeout"},
+		}},
+		{"microsoft_sql", []string{"mssql", "sqlserver"}, Connector{
+			Dialect: &mssql{},
+			Connect: connectMSSQL,
+			Options: []string{"encrypt", "trust_server_certificate", "application_name", "timeout"},
+		}},
+		{"snowflake", nil, Connector{
+			Dialect: &snowflake{},
+			Connect: connectSnowflake,
+			Options: []string{"account", "warehouse", "role", "schema", "application_name", "timezone", "statement_timeout"},
+		}},
+	} {
+		if err := RegisterDialect(d.name, d.aliases, d.connector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterDialect makes a dialect available under name and its aliases to
+// ConnectDBConfig, MockDB and ParseURL, where the names are url schemes.
+// names are case insensitive and can only be registered once.
+//
+//	err := dasorm.RegisterDialect("clickhouse", []string{"ch"}, dasorm.Connector{
+//		Dialect: &clickhouse{},
+//		Connect: connectClickhouse,
+//	})
+func RegisterDialect(name string, aliases []string, connector Connector) error {
+	if name == "" {
+		return errors.New("dialect name is empty")
+	}
+	if connector.Dialect == nil {
+		return errors.Errorf("%s dialect is nil", name)
+	}
+	names := append([]string{name}, aliases...)
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	for _, n := range names {
+		if _, ok := dialects[strings.ToLower(n)]; ok {
+			return errors.Errorf("%s dialect already registered", n)
+		}
+	}
+	d := &registeredDialect{Connector: connector, name: name}
+	for _, n := range names {
+		dialects[strings.ToLower(n)] = d
+	}
+	return nil
+}
+
+// lookupDialect returns the dialect registered under a name or alias
+func lookupDialect(name string) (*registeredDialect, error) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.Errorf("%s dialect not recognized", name)
+	}
+	return d, nil
+}
+
+// Dialects returns the names the dialects were registered under, without
+// their aliases
+func Dialects() []string {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	names := []string{}
+	for key, d := range dialects {
+		if key == strings.ToLower(d.name) {
+			names = append(names, d.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TableName returns the table of a model qualified for the tenant of the db
+func (db *DB) TableName(model *Model) string {
+	return db.tableName(model)
+}
+
+// ModelContext returns a context tagging statements with an operation on the
+// table of a model and redacting its sensitive values. it must be called
+// after the statement has been crafted so that generated ids and timestamps
+// are redacted too.
+func (db *DB) ModelContext(op string, model *Model) context.Context {
+	return db.modelContext(op, model)
+}
+
+// ModelQueryContext is ModelContext for a select, also redacting the args of
+// where clauses referencing sensitive columns and applying the timeout of
+// the query
+func (db *DB) ModelQueryContext(op string, model *Model, query Query) context.Context {
+	return db.queryContext(op, model, query)
+}
+
+// RunExec runs a statement that does not return rows
+func (db *DB) RunExec(ctx context.Context, stmt string, args ...interface{}) (sql.Result, error) {
+	return db.exec(ctx, stmt, args...)
+}
+
+// RunGet scans a single row into dest
+func (db *DB) RunGet(ctx context.Context, dest interface{}, stmt string, args ...interface{}) error {
+	return db.get(ctx, dest, stmt, args...)
+}
+
+// RunSelect scans all rows into the slice pointed to by dest
+func (db *DB) RunSelect(ctx context.Context, dest interface{}, stmt string, args ...interface{}) error {
+	return db.selectMany(ctx, dest, stmt, args...)
+}
+
+func craftCreate(table string, model *Model) string {
 	model.setID(uuid.Must(uuid.NewV4()))
 	model.touchCreatedAt()
 	model.touchUpdatedAt()
-	return InsertStmt(model.Value) + StringTuple(model.Value)
+	return insertStmt(table, model) + StringTuple(model.Value)
 }
 
-func genericExec(db *DB, stmt string) error {
-	if db.Debug {
-		printSQL(stmt)
-	}
-	if _, err := db.Exec(stmt); err != nil {
+func genericExec(ctx context.Context, db *DB, stmt string) error {
+	if _, err := db.exec(ctx, stmt); err != nil {
 		return errors.WithStack(err)
 	}
 	return nil
 }
 
-func genericExecWithID(db *DB, stmt string) (int64, error) {
-	if db.Debug {
-		printSQL(stmt)
-	}
-	res, err := db.Exec(stmt)
+func genericExecWithID(ctx context.Context, db *DB, stmt string) (int64, error) {
+	res, err := db.exec(ctx, stmt)
 	if err != nil {
 		return 0, errors.WithStack(err)
 	}
@@ -67,39 +208,37 @@ func genericExecWithID(db *DB, stmt string) (int64, error) {
 }
 
 func genericCreate(db *DB, model *Model) error {
-	id, err := genericExecWithID(db, craftCreate(model))
+	stmt := craftCreate(db.tableName(model), model)
+	id, err := genericExecWithID(db.modelContext(OpCreate, model), db, stmt)
 	if id != 0 {
 		model.setID(id)
 	}
 	return err
 }
 
-func craftCreateMany(model *Model) (string, error) {
+func craftCreateMany(table string, model *Model) (string, error) {
 	tuples, err := model.ToTuples()
 	if err != nil {
 		return "", errors.Wrap(err, "to tuples")
 	}
-	return InsertStmt(model.Value) + strings.Join(tuples, ","), nil
+	return insertStmt(table, model) + strings.Join(tuples, ","), nil
 }
 
 func genericCreateMany(db *DB, model *Model) error {
-	query, err := craftCreateMany(model)
+	query, err := craftCreateMany(db.tableName(model), model)
 	if err != nil {
 		return err
 	}
-	return genericExec(db, query)
+	return genericExec(db.modelContext(OpCreateMany, model), db, query)
 }
 
-func craftUpdate(model *Model) string {
-	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", model.TableName(), model.UpdateString(), model.whereID())
+func craftUpdate(table string, model *Model) string {
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, model.UpdateString(), model.whereID())
 }
 
 func genericUpdate(db *DB, model *Model) error {
-	stmt := craftUpdate(model)
-	if db.Debug {
-		printSQL(stmt)
-	}
-	res, err := db.NamedExec(stmt, model.Value)
+	stmt := craftUpdate(db.tableName(model), model)
+	res, err := db.namedExec(db.modelContext(OpUpdate, model), stmt, model.Value)
 	if err != nil {
 		return errors.Wrap(err, "updating record")
 	}
@@ -109,15 +248,16 @@ func genericUpdate(db *DB, model *Model) error {
 	return nil
 }
 
-func craftDestroy(model *Model) string {
-	return fmt.Sprintf("DELETE FROM %s WHERE %s", model.TableName(), model.whereID())
+func craftDestroy(table string, model *Model) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", table, model.whereID())
 }
 
 func genericDestroy(db *DB, model *Model) error {
-	return genericExec(db, craftDestroy(model))
+	stmt := craftDestroy(db.tableName(model), model)
+	return genericExec(db.modelContext(OpDestroy, model), db, stmt)
 }
 
-func craftDestroyMany(model *Model) (string, error) {
+func craftDestroyMany(table string, model *Model) (string, error) {
 	ids := []string{}
 	if !model.isSlice() {
 		return "", errors.New("must supply slice")
@@ -141,23 +281,20 @@ func craftDestroyMany(model *Model) (string, error) {
 		}
 		ids = append(ids, fmt.Sprintf("'%s'", id))
 	}
-	return fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", model.TableName(), strings.Join(ids, ",")), nil
+	return fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", table, strings.Join(ids, ",")), nil
 }
 
 func genericDestroyMany(db *DB, model *Model) error {
-	query, err := craftDestroyMany(model)
+	query, err := craftDestroyMany(db.tableName(model), model)
 	if err != nil {
 		return errors.Wrap(err, "craft destroy many")
 	}
-	return genericExec(db, query)
+	return genericExec(db.modelContext(OpDestroyMany, model), db, query)
 }
 
 func genericSelectOne(db *DB, model *Model, query Query) error {
 	sql, args := query.ToSQL(model)
-	if db.Debug {
-		printSQL(sql)
-	}
-	if err := db.Get(model.Value, sql, args...); err != nil {
+	if err := db.get(db.queryContext(OpSelectOne, model, query), model.Value, sql, args...); err != nil {
 		return err
 	}
 	return nil
@@ -165,10 +302,7 @@ func genericSelectOne(db *DB, model *Model, query Query) error {
 
 func genericSelectMany(db *DB, models *Model, query Query) error {
 	sql, args := query.ToSQL(models)
-	if db.Debug {
-		printSQL(sql)
-	}
-	if err := db.Select(models.Value, sql, args...); err != nil {
+	if err := db.selectMany(db.queryContext(OpSelectMany, models, query), models.Value, sql, args...); err != nil {
 		return err
 	}
 	return nil
@@ -198,60 +332,59 @@ func genericSQLView(db *DB, model *Model, format map[string]string) error {
 	if err != nil {
 		return err
 	}
-	if db.Debug {
-		printSQL(sql)
-	}
+	ctx := db.modelContext(OpSQLView, model)
 	if model.isSlice() {
-		if err := db.Select(model.Value, sql); err != nil {
+		if err := db.selectMany(ctx, model.Value, sql); err != nil {
 			return err
 		}
 	} else {
-		if err := db.Get(model.Value, sql); err != nil {
+		if err := db.get(ctx, model.Value, sql); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func craftCreateUpdate(model *Model) string {
+func craftCreateUpdate(table string, model *Model) string {
 	model.setID(uuid.Must(uuid.NewV4()))
 	model.touchCreatedAt()
 	model.touchUpdatedAt()
-	return InsertStmt(model.Value) + StringTuple(model.Value) + model.DuplicateStmt()
+	return insertStmt(table, model) + StringTuple(model.Value) + model.DuplicateStmt()
 }
 
 func genericCreateUpdate(db *DB, model *Model) error {
-	return genericExec(db, craftCreateUpdate(model))
+	stmt := craftCreateUpdate(db.tableName(model), model)
+	return genericExec(db.modelContext(OpCreateUpdate, model), db, stmt)
 }
 
-func craftCreateManyUpdate(model *Model) (string, error) {
+func craftCreateManyUpdate(table string, model *Model) (string, error) {
 	tuples, err := model.ToTuples()
 	if err != nil {
 		return "", errors.Wrap(err, "to tuples")
 	}
-	return InsertStmt(model.Value) + strings.Join(tuples, ",") + model.DuplicateStmt(), nil
+	return insertStmt(table, model) + strings.Join(tuples, ",") + model.DuplicateStmt(), nil
 }
 
 func genericCreateManyUpdate(db *DB, model *Model) error {
-	query, err := craftCreateManyUpdate(model)
+	query, err := craftCreateManyUpdate(db.tableName(model), model)
 	if err != nil {
 		return err
 	}
-	return genericExec(db, query)
+	return genericExec(db.modelContext(OpCreateManyUpdate, model), db, query)
 }
 
-func craftCreateManyTemp(model *Model) (string, error) {
+func craftCreateManyTemp(table string, model *Model) (string, error) {
 	tuples, err := model.ToTuples()
 	if err != nil {
 		return "", errors.Wrap(err, "to tuples")
 	}
-	return InsertTempStmt(model.Value) + strings.Join(tuples, ","), nil
+	return insertTempStmt(table, model) + strings.Join(tuples, ","), nil
 }
 
 func genericCreateManyTemp(db *DB, model *Model) error {
-	query, err := craftCreateManyTemp(model)
+	query, err := craftCreateManyTemp(db.tableName(model), model)
 	if err != nil {
 		return err
 	}
-	return genericExec(db, query)
+	return genericExec(db.modelContext(OpCreateManyTemp, model), db, query)
 }
@@ -0,0 +1,128 @@
+package dasorm_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingDriver keeps the statements it executes
+type recordingDriver struct {
+	mu    sync.Mutex
+	stmts []string
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.d, query}, nil
+}
+func (recordingConn) Close() error              { return nil }
+func (recordingConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (recordingStmt) Close() error  { return nil }
+func (recordingStmt) NumInput() int { return -1 }
+
+func (s recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	s.d.stmts = append(s.d.stmts, s.query)
+	s.d.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+func (recordingStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("no rows") }
+
+var recorder = &recordingDriver{}
+
+// upsertOnly is a dialect that only knows how to create records
+type upsertOnly struct{}
+
+var errUnsupported = errors.New("unsupported")
+
+func (upsertOnly) Name() string                 { return "upsert_only" }
+func (upsertOnly) TranslateSQL(s string) string { return s }
+
+func (upsertOnly) Create(db *dasorm.DB, m *dasorm.Model) error {
+	stmt := fmt.Sprintf("UPSERT INTO %s VALUES %s", db.TableName(m), dasorm.StringTuple(m.Value))
+	_, err := db.RunExec(db.ModelContext(dasorm.OpCreate, m), stmt)
+	return err
+}
+
+func (upsertOnly) CreateUpdate(*dasorm.DB, *dasorm.Model) error               { return errUnsupported }
+func (upsertOnly) CreateMany(*dasorm.DB, *dasorm.Model) error                 { return errUnsupported }
+func (upsertOnly) CreateManyTemp(*dasorm.DB, *dasorm.Model) error             { return errUnsupported }
+func (upsertOnly) CreateManyUpdate(*dasorm.DB, *dasorm.Model) error           { return errUnsupported }
+func (upsertOnly) Update(*dasorm.DB, *dasorm.Model) error                     { return errUnsupported }
+func (upsertOnly) Destroy(*dasorm.DB, *dasorm.Model) error                    { return errUnsupported }
+func (upsertOnly) DestroyMany(*dasorm.DB, *dasorm.Model) error                { return errUnsupported }
+func (upsertOnly) SelectOne(*dasorm.DB, *dasorm.Model, dasorm.Query) error    { return errUnsupported }
+func (upsertOnly) SelectMany(*dasorm.DB, *dasorm.Model, dasorm.Query) error   { return errUnsupported }
+func (upsertOnly) SQLView(*dasorm.DB, *dasorm.Model, map[string]string) error { return errUnsupported }
+
+// infoHook keeps the query info of the statements it sees
+type infoHook struct{ infos []dasorm.QueryInfo }
+
+func (h *infoHook) BeforeQuery(ctx context.Context, _ string, _ []interface{}) context.Context {
+	h.infos = append(h.infos, dasorm.QueryInfoFromContext(ctx))
+	return ctx
+}
+
+func (*infoHook) AfterQuery(context.Context, string, []interface{}, sql.Result, error, time.Duration) {
+}
+
+type widget struct {
+	ID   uuid.UUID `db:"id"`
+	Name string    `db:"name"`
+}
+
+func (widget) TableName() string { return "widgets" }
+
+func init() {
+	sql.Register("dasorm_recording", recorder)
+}
+
+func TestRegisteredDialect(t *testing.T) {
+	err := dasorm.RegisterDialect("upsert_only", []string{"upsert"}, dasorm.Connector{Dialect: upsertOnly{}})
+	assert.NoError(t, err)
+	assert.Contains(t, dasorm.Dialects(), "upsert_only")
+
+	db, err := sql.Open("dasorm_recording", "")
+	assert.NoError(t, err)
+	conn, err := dasorm.NewMockDB(db, "UPSERT")
+	assert.NoError(t, err)
+	hook := &infoHook{}
+	conn.AddHook(hook)
+
+	acme, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+	assert.NoError(t, acme.Create(&widget{Name: "bolt"}))
+	assert.Equal(t, errUnsupported, conn.Destroy(&widget{}))
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Len(t, recorder.stmts, 1)
+	assert.Contains(t, recorder.stmts[0], "UPSERT INTO acme.widgets VALUES ")
+	assert.Contains(t, recorder.stmts[0], "'bolt'")
+	assert.Equal(t, []dasorm.QueryInfo{{Dialect: "upsert_only", Operation: dasorm.OpCreate, Table: "acme.widgets"}}, hook.infos)
+
+	_, err = dasorm.NewMockDB(db, "upsert_only")
+	assert.NoError(t, err)
+	err = dasorm.RegisterDialect("upsert", nil, dasorm.Connector{Dialect: upsertOnly{}})
+	assert.EqualError(t, err, "upsert dialect already registered")
+}
@@ -4,3 +4,6 @@ import "github.com/pkg/errors"
 
 // ErrNotImplemented for things that haven't been implemented
 var ErrNotImplemented = errors.New("not implemented")
+
+// ErrNoTable is returned by DescribeTable for tables that do not exist
+var ErrNoTable = errors.New("table does not exist")
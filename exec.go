@@ -0,0 +1,174 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"time"
+)
+
+// logger returns the logger entries should be sent to, if any
+func (db *DB) logger() Logger {
+	if db.Logger != nil {
+		return db.Logger
+	}
+	if db.Debug {
+		return colorLogger{}
+	}
+	return nil
+}
+
+func (db *DB) logQuery(stmt string, args []interface{}, dur time.Duration, rows int64, err error) {
+	l := db.logger()
+	if l == nil && db.SlowLog == nil {
+		return
+	}
+	entry := &LogEntry{
+		Statement:    stmt,
+		Args:         args,
+		Duration:     dur,
+		RowsAffected: rows,
+		Err:          err,
+	}
+	if l != nil || entry.Duration > db.SlowLog.Threshold {
+		entry.Caller = callerSite()
+	}
+	if l != nil {
+		l.Log(entry)
+	}
+	if db.SlowLog != nil {
+		db.SlowLog.observe(entry)
+	}
+}
+
+type runFunc func(ctx context.Context) (sql.Result, int64, error)
+
+// run executes fn surrounded by the hook chain and reports it to the loggers.
+// every statement issued by the orm or the raw wrappers passes through here.
+// hooks and loggers only ever see the redacted statement and args.
+func (db *DB) run(ctx context.Context, stmt string, args []interface{}, fn runFunc) (sql.Result, error) {
+	if db.err != nil {
+		fn = func(context.Context) (sql.Result, int64, error) { return nil, 0, db.err }
+	}
+	logStmt, logArgs := stmt, args
+	r := redactorFromContext(ctx)
+	if r != nil {
+		logStmt, logArgs = r.Statement(stmt), r.Args(args)
+	}
+	for _, h := range db.Hooks {
+		ctx = h.BeforeQuery(ctx, logStmt, logArgs)
+	}
+	start := time.Now()
+	res, rows, err := fn(ctx)
+	dur := time.Since(start)
+	if r != nil {
+		err = r.Error(err)
+	}
+	for i := len(db.Hooks) - 1; i >= 0; i-- {
+		db.Hooks[i].AfterQuery(ctx, logStmt, logArgs, res, err, dur)
+	}
+	db.logQuery(logStmt, logArgs, dur, rows, err)
+	return res, err
+}
+
+// exec runs a statement that does not return rows
+func (db *DB) exec(ctx context.Context, stmt string, args ...interface{}) (sql.Result, error) {
+	ctx = db.withOperation(ctx, OpExec, "")
+	return db.run(ctx, stmt, args, func(ctx context.Context) (sql.Result, int64, error) {
+		var res sql.Result
+		err := db.timed(ctx, stmt, func(ctx context.Context, q queryer, stmt string) error {
+			var err error
+			res, err = q.ExecContext(ctx, stmt, args...)
+			return err
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		rows, _ := res.RowsAffected()
+		return res, rows, nil
+	})
+}
+
+// namedExec binds the named parameters in stmt from arg and executes it
+func (db *DB) namedExec(ctx context.Context, stmt string, arg interface{}) (sql.Result, error) {
+	bound, args, err := db.pool().BindNamed(stmt, arg)
+	if err != nil {
+		if r := redactorFromContext(ctx); r != nil {
+			err = r.Error(err)
+		}
+		db.logQuery(stmt, nil, 0, 0, err)
+		return nil, err
+	}
+	return db.exec(ctx, bound, args...)
+}
+
+// get scans a single row into dest
+func (db *DB) get(ctx context.Context, dest interface{}, stmt string, args ...interface{}) error {
+	ctx = db.withOperation(ctx, OpQueryRow, "")
+	_, err := db.run(ctx, stmt, args, func(ctx context.Context) (sql.Result, int64, error) {
+		err := db.timed(ctx, stmt, func(ctx context.Context, q queryer, stmt string) error {
+			return q.GetContext(ctx, dest, stmt, args...)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return driver.RowsAffected(1), 1, nil
+	})
+	return err
+}
+
+// selectMany scans all rows into the slice pointed to by dest
+func (db *DB) selectMany(ctx context.Context, dest interface{}, stmt string, args ...interface{}) error {
+	ctx = db.withOperation(ctx, OpQuery, "")
+	_, err := db.run(ctx, stmt, args, func(ctx context.Context) (sql.Result, int64, error) {
+		err := db.timed(ctx, stmt, func(ctx context.Context, q queryer, stmt string) error {
+			return q.SelectContext(ctx, dest, stmt, args...)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		rows := int64(reflect.Indirect(reflect.ValueOf(dest)).Len())
+		return driver.RowsAffected(rows), rows, nil
+	})
+	return err
+}
+
+// query runs a statement returning rows
+func (db *DB) query(ctx context.Context, stmt string, args ...interface{}) (*sql.Rows, error) {
+	ctx = db.withOperation(ctx, OpQuery, "")
+	var rows *sql.Rows
+	_, err := db.run(ctx, stmt, args, func(ctx context.Context) (sql.Result, int64, error) {
+		err := db.timedRows(ctx, func(ctx context.Context) error {
+			var err error
+			rows, err = db.pool().QueryContext(ctx, stmt, args...)
+			return err
+		})
+		return nil, 0, err
+	})
+	return rows, err
+}
+
+// queryRow runs a statement returning at most one row
+func (db *DB) queryRow(ctx context.Context, stmt string, args ...interface{}) *sql.Row {
+	ctx = db.withOperation(ctx, OpQueryRow, "")
+	var row *sql.Row
+	db.run(ctx, stmt, args, func(ctx context.Context) (sql.Result, int64, error) {
+		err := db.timedRows(ctx, func(ctx context.Context) error {
+			row = db.pool().QueryRowContext(ctx, stmt, args...)
+			return row.Err()
+		})
+		return nil, 0, err
+	})
+	if row == nil {
+		row = errRow(db.err)
+	}
+	return row
+}
+
+// errRow returns a row whose Scan fails with err
+func errRow(err error) *sql.Row {
+	pool := sql.OpenDB(failedConnector{err})
+	defer pool.Close()
+	return pool.QueryRow("")
+}
@@ -1,6 +1,6 @@
 module github.com/estenssoros/dasorm
 
-go 1.13
+go 1.16
 
 require (
 	github.com/SermoDigital/jose v0.9.2-0.20180104203859-803625baeddc // indirect
@@ -8,6 +8,7 @@ require (
 	github.com/denisenkom/go-mssqldb v0.0.0-20190820223206-44cdfe8d8ba9
 	github.com/fatih/color v1.7.0
 	github.com/go-sql-driver/mysql v1.4.1
+	github.com/google/go-cmp v0.5.6 // indirect
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/imkira/go-interpol v1.1.0
@@ -16,8 +17,13 @@ require (
 	github.com/lib/pq v1.2.0
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/pkg/browser v0.0.0-20180916011732-0a3d74bf9ce4 // indirect
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
 	github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
 	github.com/snowflakedb/gosnowflake v1.3.0
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
+	golang.org/x/sys v0.0.0-20210603081109-ebe580a85c40 // indirect
+	golang.org/x/text v0.3.2 // indirect
+	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,213 @@
+package dasorm
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HealthStatus is the result of the latest health check of a connection
+type HealthStatus struct {
+	Healthy   bool
+	LastCheck time.Time
+	Latency   time.Duration
+	LastError error
+	// Failures counts the consecutive failed checks
+	Failures   int
+	Reconnects int
+}
+
+// HealthMonitor configures the background health checks of a connection
+type HealthMonitor struct {
+	// Interval between checks. defaults to 30s
+	Interval time.Duration
+	// Timeout of each ping. defaults to 5s
+	Timeout time.Duration
+	// ReconnectAfter is the number of consecutive failed checks after which
+	// the pool is rebuilt with a config fetched again from the connection's
+	// config source. defaults to 3, negative never reconnects.
+	ReconnectAfter int
+	// OnChange is called when the connection turns healthy or unhealthy
+	OnChange func(HealthStatus)
+}
+
+func (m HealthMonitor) withDefaults() HealthMonitor {
+	if m.Interval <= 0 {
+		m.Interval = 30 * time.Second
+	}
+	if m.Timeout <= 0 {
+		m.Timeout = 5 * time.Second
+	}
+	if m.ReconnectAfter == 0 {
+		m.ReconnectAfter = 3
+	}
+	return m
+}
+
+// healthMonitor runs the checks of a connection
+type healthMonitor struct {
+	HealthMonitor
+	db *DB
+
+	mu     sync.Mutex
+	status HealthStatus
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// check pings the pool, reconnecting once too many checks failed in a row
+func (h *healthMonitor) check() HealthStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := h.db.pool().PingContext(ctx)
+	latency := time.Since(start)
+
+	h.mu.Lock()
+	prev := h.status
+	status := prev
+	status.LastCheck = start
+	status.Latency = latency
+	status.LastError = err
+	status.Healthy = err == nil
+	if err == nil {
+		status.Failures = 0
+	} else {
+		status.Failures++
+	}
+	h.status = status
+	h.mu.Unlock()
+
+	if err != nil && h.ReconnectAfter > 0 && status.Failures >= h.ReconnectAfter {
+		if rerr := h.reconnect(); rerr != nil {
+			log.Printf("[dasorm] reconnect: %v", rerr)
+		} else {
+			h.mu.Lock()
+			h.status.Reconnects++
+			h.status.Failures = 0
+			status = h.status
+			h.mu.Unlock()
+		}
+	}
+	if prev.LastCheck.IsZero() || prev.Healthy != status.Healthy {
+		if !status.Healthy {
+			log.Printf("[dasorm] connection unhealthy: %v", err)
+		}
+		if h.OnChange != nil {
+			h.OnChange(status)
+		}
+	}
+	return status
+}
+
+// reconnect rebuilds the pool with a freshly fetched config. the old pool is
+// closed once the statements, transactions and rows using it are done.
+func (h *healthMonitor) reconnect() error {
+	if h.db.source == nil {
+		return errors.New("connection has no config source")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	config, err := h.db.source(ctx)
+	if err != nil {
+		return err
+	}
+	conn, err := connectConfig(config)
+	if err != nil {
+		return err
+	}
+	old, ok := h.db.swapPool(conn.DB.pool())
+	if !ok {
+		conn.Close()
+		return errors.New("connection is closed")
+	}
+	closeDrained(old, nil)
+	return nil
+}
+
+func (h *healthMonitor) run(stop chan struct{}) {
+	defer close(h.done)
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			h.check()
+		}
+	}
+}
+
+// halt stops the checks and waits for a running check to finish
+func (h *healthMonitor) halt() {
+	h.mu.Lock()
+	stop := h.stop
+	h.stop = nil
+	h.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-h.done
+	}
+}
+
+// MonitorHealth checks the connection in the background, replacing any
+// running monitor. the monitor stops when the connection is closed.
+func (c *Connection) MonitorHealth(m HealthMonitor) {
+	stop := make(chan struct{})
+	h := &healthMonitor{
+		HealthMonitor: m.withDefaults(),
+		db:            c.DB,
+		stop:          stop,
+		done:          make(chan struct{}),
+	}
+	// the monitor is published after its first check so Health never
+	// returns the empty status of a check that has not run
+	h.check()
+	c.DB.mu.Lock()
+	if c.DB.closed {
+		c.DB.mu.Unlock()
+		return
+	}
+	prev := c.DB.health
+	c.DB.health = h
+	c.DB.closers = append(c.DB.closers, h.halt)
+	c.DB.mu.Unlock()
+	if prev != nil {
+		prev.halt()
+	}
+	go h.run(stop)
+}
+
+// StopHealthMonitor stops the background health checks
+func (c *Connection) StopHealthMonitor() {
+	c.DB.mu.RLock()
+	h := c.DB.health
+	c.DB.mu.RUnlock()
+	if h != nil {
+		h.halt()
+	}
+}
+
+// Health returns the status of the latest health check. without a running
+// monitor the connection is checked right away.
+func (c *Connection) Health() HealthStatus {
+	c.DB.mu.RLock()
+	h := c.DB.health
+	c.DB.mu.RUnlock()
+	if h == nil {
+		h = &healthMonitor{HealthMonitor: HealthMonitor{ReconnectAfter: -1}.withDefaults(), db: c.DB}
+		return h.check()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Healthy reports whether the latest health check passed
+func (c *Connection) Healthy() bool {
+	return c.Health().Healthy
+}
@@ -0,0 +1,142 @@
+package dasorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	conn, _ := newFakeConnection(t, "postgres")
+	var (
+		mu      sync.Mutex
+		changes []bool
+	)
+	connectConfig = func(config *Config) (*Connection, error) {
+		fresh, _ := newFakeConnection(t, "postgres")
+		return fresh, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+	conn.DB.source = func(context.Context) (*Config, error) {
+		return &Config{Dialect: "postgres"}, nil
+	}
+
+	conn.MonitorHealth(HealthMonitor{
+		Interval:       10 * time.Millisecond,
+		ReconnectAfter: 2,
+		OnChange: func(s HealthStatus) {
+			mu.Lock()
+			changes = append(changes, s.Healthy)
+			mu.Unlock()
+		},
+	})
+	assert.True(t, conn.Healthy())
+
+	conn.DB.pool().Close()
+	assert.Eventually(t, func() bool { return conn.Health().Reconnects == 1 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, conn.Healthy, time.Second, 5*time.Millisecond)
+	assert.NoError(t, conn.Ping())
+
+	h := conn.DB.health
+	conn.Close()
+	select {
+	case <-h.done:
+	case <-time.After(time.Second):
+		t.Fatal("monitor still running after close")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []bool{true, false, true}, changes)
+}
+
+func TestHealthReconnectDrains(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	connectConfig = func(config *Config) (*Connection, error) {
+		fresh, _ := newFakeConnection(t, "postgres")
+		return fresh, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+	conn.DB.source = func(context.Context) (*Config, error) {
+		return &Config{Dialect: "postgres"}, nil
+	}
+	old := conn.DB.pool()
+	tx, err := conn.Begin()
+	assert.NoError(t, err)
+
+	// pings time out, the pool is replaced while the transaction runs on it
+	fake.mu.Lock()
+	fake.pingDelay = time.Second
+	fake.mu.Unlock()
+	conn.MonitorHealth(HealthMonitor{Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond, ReconnectAfter: 1})
+	defer conn.Close()
+	assert.Eventually(t, func() bool { return conn.Health().Reconnects == 1 }, time.Second, 5*time.Millisecond)
+	fake.mu.Lock()
+	fake.pingDelay = 0
+	fake.mu.Unlock()
+	time.Sleep(3 * drainInterval)
+	assert.NoError(t, old.Ping(), "the old pool stays open while in use")
+	_, err = tx.Exec("SELECT 1")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Eventually(t, func() bool { return old.Ping() != nil }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"SELECT 1"}, fake.Statements())
+}
+
+func TestHealthDuringFirstCheck(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	conn.MonitorHealth(HealthMonitor{Interval: time.Hour})
+	fake.mu.Lock()
+	fake.pingDelay = 50 * time.Millisecond
+	fake.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.MonitorHealth(HealthMonitor{Interval: time.Hour})
+	}()
+	for {
+		select {
+		case <-done:
+			assert.True(t, conn.Healthy())
+			conn.Close()
+			return
+		default:
+			status := conn.Health()
+			assert.False(t, !status.Healthy && status.LastError == nil, "health read before the first check")
+		}
+	}
+}
+
+func TestHealthWithoutMonitor(t *testing.T) {
+	conn, _ := newFakeConnection(t, "mysql")
+	status := conn.Health()
+	assert.True(t, status.Healthy)
+	assert.NoError(t, status.LastError)
+	conn.DB.pool().Close()
+	assert.False(t, conn.Healthy())
+	assert.EqualError(t, conn.Health().LastError, "sql: database is closed")
+}
+
+func TestConnectDBProviderTimeout(t *testing.T) {
+	late := make(chan *Connection, 1)
+	connectConfig = func(config *Config) (*Connection, error) {
+		time.Sleep(50 * time.Millisecond)
+		conn, _ := newFakeConnection(t, "postgres")
+		late <- conn
+		return conn, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+	provider := ConfigProviderFunc(func(ctx context.Context, env string) (*Config, error) {
+		return &Config{Dialect: "postgres"}, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := ConnectDBProvider(ctx, provider, "dev")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	conn := <-late
+	assert.Eventually(t, func() bool { return conn.DB.pool().Ping() != nil }, time.Second, 5*time.Millisecond,
+		"a connection finished after the timeout should be closed")
+}
@@ -276,6 +276,12 @@ func MapToStruct(v interface{}, m map[string]interface{}) error {
 
 // StringTuple converts struct to MySQL compatible string tuple
 func StringTuple(c interface{}) string {
+	return stringTuple(c, nil)
+}
+
+// stringTuple converts a struct to a string tuple, replacing the value of
+// every column in masked with the redaction mask
+func stringTuple(c interface{}, masked map[string]bool) string {
 	fields := reflect.TypeOf(c)
 	values := reflect.ValueOf(c)
 	if values.Kind() == reflect.Ptr {
@@ -287,7 +293,12 @@ func StringTuple(c interface{}) string {
 	for i := 0; i < numFields; i++ {
 		field := fields.Field(i)
 		value := values.Field(i)
-		if tag := field.Tag.Get("db"); tag == "" {
+		tag := field.Tag.Get("db")
+		if tag == "" {
+			continue
+		}
+		if masked[tag] {
+			stringSlice = append(stringSlice, fmt.Sprintf("'%s'", redactionPolicy.mask()))
 			continue
 		}
 		kind := ValueKind(value)
@@ -0,0 +1,93 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// operation names reported to hooks
+const (
+	OpCreate           = "create"
+	OpCreateMany       = "create_many"
+	OpCreateManyTemp   = "create_many_temp"
+	OpCreateUpdate     = "create_update"
+	OpCreateManyUpdate = "create_many_update"
+	OpUpdate           = "update"
+	OpDestroy          = "destroy"
+	OpDestroyMany      = "destroy_many"
+	OpSelectOne        = "select_one"
+	OpSelectMany       = "select_many"
+	OpSQLView          = "sql_view"
+	OpExec             = "exec"
+	OpQuery            = "query"
+	OpQueryRow         = "query_row"
+	OpWriteTuples      = "write_tuples"
+)
+
+// Hook is called around every statement executed through a Connection.
+// BeforeQuery may return a derived context, which is used for the statement
+// and passed to AfterQuery.
+type Hook interface {
+	BeforeQuery(ctx context.Context, stmt string, args []interface{}) context.Context
+	AfterQuery(ctx context.Context, stmt string, args []interface{}, result sql.Result, err error, dur time.Duration)
+}
+
+// AddHook appends hooks to the chain. BeforeQuery is called in the order the
+// hooks were added and AfterQuery in the reverse order.
+func (c *Connection) AddHook(hooks ...Hook) {
+	c.DB.Hooks = append(c.DB.Hooks, hooks...)
+}
+
+// QueryInfo describes the orm operation a statement belongs to
+type QueryInfo struct {
+	Dialect   string
+	Operation string
+	Table     string
+}
+
+type queryInfoKey struct{}
+
+// QueryInfoFromContext returns the query info for a statement. it is always
+// set on the context passed to hooks.
+func QueryInfoFromContext(ctx context.Context) QueryInfo {
+	info, _ := ctx.Value(queryInfoKey{}).(QueryInfo)
+	return info
+}
+
+// withOperation tags ctx with an operation unless an outer call already has
+func (db *DB) withOperation(ctx context.Context, op, table string) context.Context {
+	if _, ok := ctx.Value(queryInfoKey{}).(QueryInfo); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, queryInfoKey{}, QueryInfo{
+		Dialect:   db.dialect,
+		Operation: op,
+		Table:     table,
+	})
+}
+
+// modelContext returns a context tagged with an operation on model's table.
+// it must be called after the statement has been crafted so that generated
+// ids and timestamps are part of the redacted values.
+func (db *DB) modelContext(op string, model *Model) context.Context {
+	ctx := db.withOperation(context.Background(), op, db.tableName(model))
+	return withRedactor(ctx, model.redactor())
+}
+
+// queryContext returns a model context that also redacts the args of where
+// clauses referencing sensitive columns
+func (db *DB) queryContext(op string, model *Model, query Query) context.Context {
+	ctx := db.withOperation(context.Background(), op, db.tableName(model))
+	if query.timeout > 0 {
+		ctx = withTimeout(ctx, query.timeout)
+	}
+	cols := model.sensitiveColumns()
+	if len(cols) == 0 {
+		return ctx
+	}
+	r := newRedactor()
+	r.addClauses(query.whereClauses, cols)
+	r.addClauses(clauses{*query.RawSQL}, cols)
+	return withRedactor(ctx, r)
+}
@@ -0,0 +1,72 @@
+// Package otelhook traces dasorm statements with OpenTelemetry
+package otelhook
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/estenssoros/dasorm"
+
+// Hook starts a client span for every statement
+type Hook struct {
+	tracer trace.Tracer
+}
+
+// New creates a tracing hook. a nil provider uses the global tracer provider.
+func New(tp trace.TracerProvider) *Hook {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Hook{tracer: tp.Tracer(instrumentationName)}
+}
+
+// dbSystem maps a dasorm dialect to the semantic convention db.system value
+func dbSystem(dialect string) attribute.KeyValue {
+	switch dialect {
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "mssql":
+		return semconv.DBSystemMSSQL
+	default:
+		return semconv.DBSystemKey.String(dialect)
+	}
+}
+
+// BeforeQuery starts a span named after the operation
+func (h *Hook) BeforeQuery(ctx context.Context, stmt string, args []interface{}) context.Context {
+	info := dasorm.QueryInfoFromContext(ctx)
+	attrs := []attribute.KeyValue{
+		dbSystem(info.Dialect),
+		semconv.DBStatementKey.String(stmt),
+		semconv.DBOperationKey.String(info.Operation),
+	}
+	if info.Table != "" {
+		attrs = append(attrs, semconv.DBSQLTableKey.String(info.Table))
+	}
+	ctx, _ = h.tracer.Start(ctx, "dasorm."+info.Operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+// AfterQuery records the outcome and ends the span
+func (h *Hook) AfterQuery(ctx context.Context, stmt string, args []interface{}, result sql.Result, err error, dur time.Duration) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
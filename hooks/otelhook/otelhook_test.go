@@ -0,0 +1,116 @@
+package otelhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/estenssoros/dasorm"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fakeDriver succeeds every statement but "fail"
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "fail" {
+		return nil, errors.New("fail")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("no rows") }
+
+func init() {
+	sql.Register("otelhook_fake", fakeDriver{})
+}
+
+// recorder is a tracer provider keeping the spans it starts
+type recorder struct {
+	spans []*span
+}
+
+func (r *recorder) Tracer(string, ...trace.TracerOption) trace.Tracer { return r }
+
+func (r *recorder) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	s := &span{
+		Span:  trace.SpanFromContext(context.Background()),
+		name:  name,
+		kind:  config.SpanKind(),
+		attrs: config.Attributes(),
+	}
+	r.spans = append(r.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	trace.Span
+	name  string
+	kind  trace.SpanKind
+	attrs []attribute.KeyValue
+	code  codes.Code
+	errs  []error
+	ended bool
+}
+
+func (s *span) End(...trace.SpanEndOption)                    { s.ended = true }
+func (s *span) RecordError(err error, _ ...trace.EventOption) { s.errs = append(s.errs, err) }
+func (s *span) SetStatus(code codes.Code, _ string)           { s.code = code }
+
+type user struct {
+	ID uuid.UUID `db:"id"`
+}
+
+func (user) TableName() string { return "users" }
+
+func TestHook(t *testing.T) {
+	rec := &recorder{}
+	db, err := sql.Open("otelhook_fake", "")
+	assert.NoError(t, err)
+	conn := dasorm.MockDB(db, "postgres")
+	conn.AddHook(New(rec))
+
+	assert.NoError(t, conn.Destroy(&user{}))
+	_, err = conn.Exec("fail")
+	assert.Error(t, err)
+
+	assert.Len(t, rec.spans, 2)
+	destroy := rec.spans[0]
+	assert.Equal(t, "dasorm.destroy", destroy.name)
+	assert.Equal(t, trace.SpanKindClient, destroy.kind)
+	assert.Contains(t, destroy.attrs, semconv.DBSystemPostgreSQL)
+	assert.Contains(t, destroy.attrs, semconv.DBOperationKey.String(dasorm.OpDestroy))
+	assert.Contains(t, destroy.attrs, semconv.DBSQLTableKey.String("users"))
+	assert.True(t, destroy.ended)
+	assert.Equal(t, codes.Unset, destroy.code)
+
+	exec := rec.spans[1]
+	assert.Equal(t, "dasorm.exec", exec.name)
+	assert.Contains(t, exec.attrs, semconv.DBStatementKey.String("fail"))
+	assert.True(t, exec.ended)
+	assert.Equal(t, codes.Error, exec.code)
+	assert.EqualError(t, exec.errs[0], "fail")
+
+	assert.NotNil(t, New(nil).tracer, "nil uses the global provider")
+}
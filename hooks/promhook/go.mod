@@ -0,0 +1,12 @@
+module github.com/estenssoros/dasorm/hooks/promhook
+
+go 1.16
+
+require (
+	github.com/estenssoros/dasorm v0.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.11.1
+	github.com/satori/go.uuid v1.2.1-0.20181028125025-b2ce2384e17b
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/estenssoros/dasorm => ../..
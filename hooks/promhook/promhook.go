@@ -0,0 +1,70 @@
+// Package promhook records dasorm statement metrics with Prometheus
+package promhook
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labels = []string{"dialect", "operation", "table", "status"}
+
+// Hook counts statements and observes their durations
+type Hook struct {
+	queries  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// New creates a metrics hook and registers its collectors with reg.
+// a nil registerer uses prometheus.DefaultRegisterer.
+func New(reg prometheus.Registerer, namespace string) (*Hook, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	h := &Hook{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "dasorm",
+			Name:      "queries_total",
+			Help:      "Number of statements executed.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "dasorm",
+			Name:      "query_duration_seconds",
+			Help:      "Statement execution duration.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+	if err := reg.Register(h.queries); err != nil {
+		return nil, err
+	}
+	if err := reg.Register(h.duration); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// BeforeQuery is a no-op
+func (h *Hook) BeforeQuery(ctx context.Context, stmt string, args []interface{}) context.Context {
+	return ctx
+}
+
+// AfterQuery records the statement. the table label leaves out the schema or
+// database qualifying the table of a tenant so the number of series does not
+// grow with the tenants.
+func (h *Hook) AfterQuery(ctx context.Context, stmt string, args []interface{}, result sql.Result, err error, dur time.Duration) {
+	info := dasorm.QueryInfoFromContext(ctx)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	table := info.Table[strings.LastIndex(info.Table, ".")+1:]
+	values := []string{info.Dialect, info.Operation, table, status}
+	h.queries.WithLabelValues(values...).Inc()
+	h.duration.WithLabelValues(values...).Observe(dur.Seconds())
+}
@@ -0,0 +1,75 @@
+package promhook
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/estenssoros/dasorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver succeeds every statement but "fail"
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("no transactions") }
+
+type fakeStmt struct{ query string }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "fail" {
+		return nil, errors.New("fail")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("no rows") }
+
+func init() {
+	sql.Register("promhook_fake", fakeDriver{})
+}
+
+type user struct {
+	ID uuid.UUID `db:"id"`
+}
+
+func (user) TableName() string { return "users" }
+
+func TestHook(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h, err := New(reg, "app")
+	assert.NoError(t, err)
+	_, err = New(reg, "app")
+	assert.Error(t, err, "collectors register once")
+
+	db, err := sql.Open("promhook_fake", "")
+	assert.NoError(t, err)
+	conn := dasorm.MockDB(db, "postgres")
+	conn.AddHook(h)
+	assert.NoError(t, conn.Destroy(&user{}))
+	acme, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+	assert.NoError(t, acme.Destroy(&user{}), "tenant tables share the label of the table")
+	_, err = conn.Exec("fail")
+	assert.Error(t, err)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(h.queries.WithLabelValues("postgres", dasorm.OpDestroy, "users", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(h.queries.WithLabelValues("postgres", dasorm.OpExec, "", "error")))
+	assert.Equal(t, 2, testutil.CollectAndCount(h.duration))
+	n, err := testutil.GatherAndCount(reg, "app_dasorm_queries_total")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
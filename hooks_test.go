@@ -0,0 +1,60 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordHook struct {
+	name  string
+	calls *[]string
+	infos *[]QueryInfo
+}
+
+type hookKey struct{}
+
+func (h recordHook) BeforeQuery(ctx context.Context, stmt string, args []interface{}) context.Context {
+	*h.calls = append(*h.calls, "before "+h.name)
+	return context.WithValue(ctx, hookKey{}, h.name)
+}
+
+func (h recordHook) AfterQuery(ctx context.Context, stmt string, args []interface{}, result sql.Result, err error, dur time.Duration) {
+	*h.calls = append(*h.calls, "after "+h.name+" "+ctx.Value(hookKey{}).(string))
+	*h.infos = append(*h.infos, QueryInfoFromContext(ctx))
+}
+
+func TestHooks(t *testing.T) {
+	conn, _ := newFakeConnection(t, "postgres")
+	calls := []string{}
+	infos := []QueryInfo{}
+	conn.AddHook(
+		recordHook{name: "a", calls: &calls, infos: &infos},
+		recordHook{name: "b", calls: &calls, infos: &infos},
+	)
+
+	assert.NoError(t, conn.Destroy(NewTestStruct()))
+	assert.Equal(t, []string{"before a", "before b", "after b b", "after a b"}, calls)
+	assert.Equal(t, QueryInfo{Dialect: "postgres", Operation: OpDestroy, Table: "test"}, infos[0])
+
+	_, err := conn.Exec("DELETE FROM test")
+	assert.NoError(t, err)
+	assert.Equal(t, QueryInfo{Dialect: "postgres", Operation: OpExec}, infos[2])
+
+	assert.NoError(t, conn.All(&[]test{}))
+	assert.Equal(t, QueryInfo{Dialect: "postgres", Operation: OpSelectMany, Table: "test"}, infos[4])
+
+	session, err := conn.Conn(context.Background())
+	assert.NoError(t, err)
+	defer session.Close()
+	_, err = conn.ExecOn(context.Background(), session, "SELECT 1")
+	assert.NoError(t, err)
+	rows, err := conn.QueryOn(context.Background(), session, "SELECT 2")
+	assert.NoError(t, err)
+	rows.Close()
+	assert.Equal(t, QueryInfo{Dialect: "postgres", Operation: OpExec}, infos[6])
+	assert.Equal(t, QueryInfo{Dialect: "postgres", Operation: OpQuery}, infos[8])
+}
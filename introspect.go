@@ -0,0 +1,434 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/estenssoros/dasorm/nulls"
+	"github.com/pkg/errors"
+)
+
+// Table is the definition of a live table as read by DescribeTable
+type Table struct {
+	Schema      string
+	Name        string
+	Columns     []*Column
+	PrimaryKey  []string
+	Indexes     []*Index
+	ForeignKeys []*ForeignKey
+}
+
+// Column returns the column with a name, compared case insensitively
+func (t *Table) Column(name string) *Column {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Index is an index of a table other than its primary key. unique
+// constraints are listed as unique indexes.
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// ForeignKey is a foreign key of a table
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// identName is a part of a table name accepted by DescribeTable. names end
+// up in the introspection queries so nothing that needs quoting is allowed.
+var identName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// tableRef is a table name split into its catalog, schema and name
+type tableRef struct {
+	dialect string
+	catalog string
+	schema  string
+	name    string
+}
+
+// currentSchema is the sql of the default schema of a session
+var currentSchema = map[string]string{
+	"mysql":     "DATABASE()",
+	"postgres":  "current_schema()",
+	"mssql":     "SCHEMA_NAME()",
+	"snowflake": "CURRENT_SCHEMA()",
+}
+
+// tableRef parses a table name, qualifying it for the tenant of the
+// connection unless it is qualified already. the empty name refers to the
+// schema of the connection.
+func (c *Connection) tableRef(name string) (*tableRef, error) {
+	dialect := c.DialectName()
+	if _, ok := currentSchema[dialect]; !ok {
+		return nil, errors.Errorf("%s dialect cannot describe tables", dialect)
+	}
+	listing := name == ""
+	if q := c.qualifier(); q != "" && (listing || !strings.Contains(name, ".")) {
+		name = strings.TrimSuffix(q+"."+name, ".")
+	}
+	parts := []string{}
+	if name != "" {
+		parts = strings.Split(name, ".")
+	}
+	for _, p := range parts {
+		if !identName.MatchString(p) {
+			return nil, errors.Errorf("invalid table name %q", name)
+		}
+	}
+	if listing {
+		// a schema is listed with the parts of a table name before the table
+		parts = append(parts, "")
+	}
+	if dialect == "snowflake" {
+		for i := range parts {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	ref := &tableRef{dialect: dialect}
+	switch {
+	case len(parts) == 1:
+		ref.name = parts[0]
+	case len(parts) == 2:
+		ref.schema, ref.name = parts[0], parts[1]
+	case len(parts) == 3 && (dialect == "mssql" || dialect == "snowflake"):
+		ref.catalog, ref.schema, ref.name = parts[0], parts[1], parts[2]
+	default:
+		return nil, errors.Errorf("invalid table name %q", name)
+	}
+	return ref, nil
+}
+
+// schemaSQL is the schema of the table as sql
+func (r *tableRef) schemaSQL() string {
+	if r.schema == "" {
+		return currentSchema[r.dialect]
+	}
+	return "'" + r.schema + "'"
+}
+
+// prefix qualifies the catalog views of the database with its catalog
+func (r *tableRef) prefix(view string) string {
+	if r.catalog == "" {
+		return view
+	}
+	return r.catalog + "." + view
+}
+
+// qualified is the name of the table with the parts it was given
+func (r *tableRef) qualified() string {
+	return strings.Join(nonEmpty(r.catalog, r.schema, r.name), ".")
+}
+
+func nonEmpty(s ...string) []string {
+	out := []string{}
+	for _, v := range s {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// columnAttrsSQL selects whether columns are identities (auto increment on
+// mysql) or generated, and on mysql the attributes MODIFY COLUMN restates
+var columnAttrsSQL = map[string]string{
+	"mysql": "CASE WHEN extra LIKE '%auto_increment%' THEN 1 ELSE 0 END AS is_identity, " +
+		"CASE WHEN extra LIKE '%VIRTUAL GENERATED%' OR extra LIKE '%STORED GENERATED%' THEN 1 ELSE 0 END AS is_generated, " +
+		"column_type, extra, column_comment, collation_name",
+	"postgres": "is_identity, CASE is_generated WHEN 'ALWAYS' THEN 'YES' ELSE 'NO' END AS is_generated",
+	"mssql": "COLUMNPROPERTY(OBJECT_ID(QUOTENAME(table_catalog) + '.' + QUOTENAME(table_schema) + '.' + QUOTENAME(table_name)), column_name, 'IsIdentity') AS is_identity, " +
+		"COLUMNPROPERTY(OBJECT_ID(QUOTENAME(table_catalog) + '.' + QUOTENAME(table_schema) + '.' + QUOTENAME(table_name)), column_name, 'IsComputed') AS is_generated",
+	"snowflake": "is_identity, 'NO' AS is_generated",
+}
+
+// columnsSQL reads the columns of the table
+func (r *tableRef) columnsSQL() string {
+	return fmt.Sprintf(`SELECT table_schema, column_name, data_type, is_nullable, column_default, character_maximum_length, numeric_precision, numeric_scale, %s
+FROM %s
+WHERE table_schema = %s AND table_name = '%s'
+ORDER BY ordinal_position`, columnAttrsSQL[r.dialect], r.prefix("information_schema.columns"), r.schemaSQL(), r.name)
+}
+
+// keysSQL reads the primary and foreign keys of the table, a row per column
+// with the columns constraint_name, constraint_type, column_name, ref_table
+// and ref_column
+func (r *tableRef) keysSQL() []string {
+	switch r.dialect {
+	case "mysql":
+		return []string{fmt.Sprintf(`SELECT k.constraint_name, t.constraint_type, k.column_name, k.referenced_table_name AS ref_table, k.referenced_column_name AS ref_column
+FROM information_schema.table_constraints t
+JOIN information_schema.key_column_usage k ON k.constraint_schema = t.constraint_schema AND k.constraint_name = t.constraint_name AND k.table_name = t.table_name
+WHERE t.table_schema = %s AND t.table_name = '%s' AND t.constraint_type IN ('PRIMARY KEY', 'FOREIGN KEY')
+ORDER BY k.constraint_name, k.ordinal_position`, r.schemaSQL(), r.name)}
+	case "postgres":
+		return []string{fmt.Sprintf(`SELECT c.conname AS constraint_name, CASE c.contype WHEN 'p' THEN 'PRIMARY KEY' ELSE 'FOREIGN KEY' END AS constraint_type, a.attname AS column_name, rt.relname AS ref_table, ra.attname AS ref_column
+FROM pg_catalog.pg_constraint c
+JOIN pg_catalog.pg_class t ON t.oid = c.conrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, i)
+JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+LEFT JOIN pg_catalog.pg_class rt ON rt.oid = c.confrelid
+LEFT JOIN pg_catalog.pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = c.confkey[k.i]
+WHERE n.nspname = %s AND t.relname = '%s' AND c.contype IN ('p', 'f')
+ORDER BY c.conname, k.i`, r.schemaSQL(), r.name)}
+	case "mssql":
+		object := fmt.Sprintf("OBJECT_ID('%s')", r.qualified())
+		return []string{fmt.Sprintf(`SELECT constraint_name, constraint_type, column_name, ref_table, ref_column FROM (
+SELECT i.name AS constraint_name, 'PRIMARY KEY' AS constraint_type, c.name AS column_name, NULL AS ref_table, NULL AS ref_column, ic.key_ordinal AS position
+FROM %[1]s i
+JOIN %[2]s ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+JOIN %[3]s c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+WHERE i.object_id = %[6]s AND i.is_primary_key = 1
+UNION ALL
+SELECT fk.name, 'FOREIGN KEY', c.name, rt.name, rc.name, fc.constraint_column_id
+FROM %[4]s fk
+JOIN %[5]s fc ON fc.constraint_object_id = fk.object_id
+JOIN %[3]s c ON c.object_id = fc.parent_object_id AND c.column_id = fc.parent_column_id
+JOIN %[7]s rt ON rt.object_id = fc.referenced_object_id
+JOIN %[3]s rc ON rc.object_id = fc.referenced_object_id AND rc.column_id = fc.referenced_column_id
+WHERE fk.parent_object_id = %[6]s
+) k ORDER BY constraint_name, position`, r.prefix("sys.indexes"), r.prefix("sys.index_columns"), r.prefix("sys.columns"),
+			r.prefix("sys.foreign_keys"), r.prefix("sys.foreign_key_columns"), object, r.prefix("sys.tables"))}
+	default:
+		// snowflake keeps keys out of its information schema
+		return []string{
+			"SHOW PRIMARY KEYS IN TABLE " + r.qualified(),
+			"SHOW IMPORTED KEYS IN TABLE " + r.qualified(),
+		}
+	}
+}
+
+// indexesSQL reads the indexes of the table, a row per column with the
+// columns index_name, is_unique and column_name. snowflake has no indexes.
+func (r *tableRef) indexesSQL() string {
+	switch r.dialect {
+	case "mysql":
+		return fmt.Sprintf(`SELECT index_name, CASE non_unique WHEN 0 THEN 1 ELSE 0 END AS is_unique, column_name
+FROM information_schema.statistics
+WHERE table_schema = %s AND table_name = '%s' AND index_name <> 'PRIMARY'
+ORDER BY index_name, seq_in_index`, r.schemaSQL(), r.name)
+	case "postgres":
+		return fmt.Sprintf(`SELECT i.relname AS index_name, x.indisunique AS is_unique, a.attname AS column_name
+FROM pg_catalog.pg_index x
+JOIN pg_catalog.pg_class t ON t.oid = x.indrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_catalog.pg_class i ON i.oid = x.indexrelid
+CROSS JOIN LATERAL unnest(x.indkey::int2[]) WITH ORDINALITY AS k(attnum, i)
+JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+WHERE n.nspname = %s AND t.relname = '%s' AND NOT x.indisprimary
+ORDER BY i.relname, k.i`, r.schemaSQL(), r.name)
+	case "mssql":
+		return fmt.Sprintf(`SELECT i.name AS index_name, i.is_unique, c.name AS column_name
+FROM %s i
+JOIN %s ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+JOIN %s c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+WHERE i.object_id = OBJECT_ID('%s') AND i.is_primary_key = 0 AND i.type > 0 AND ic.is_included_column = 0
+ORDER BY i.name, ic.key_ordinal`, r.prefix("sys.indexes"), r.prefix("sys.index_columns"), r.prefix("sys.columns"), r.qualified())
+	default:
+		return ""
+	}
+}
+
+// tablesSQL lists the base tables of the schema
+func (r *tableRef) tablesSQL() string {
+	return fmt.Sprintf(`SELECT table_name
+FROM %s
+WHERE table_schema = %s AND table_type = 'BASE TABLE'
+ORDER BY table_name`, r.prefix("information_schema.tables"), r.schemaSQL())
+}
+
+// rowMap is a row keyed by lower cased column name
+type rowMap map[string]sql.NullString
+
+func (r rowMap) str(col string) string {
+	return r[col].String
+}
+
+func (r rowMap) int(col string) int {
+	i, _ := strconv.Atoi(r[col].String)
+	return i
+}
+
+func (r rowMap) bool(col string) bool {
+	switch strings.ToLower(r[col].String) {
+	case "1", "true", "t", "yes", "y":
+		return true
+	}
+	return false
+}
+
+// queryMaps runs a statement and reads its rows by column name, so results
+// can be read the same way whatever case the database gives the columns
+func (db *DB) queryMaps(ctx context.Context, stmt string) ([]rowMap, error) {
+	rows, err := db.query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	out := []rowMap{}
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range vals {
+			dest[i] = &vals[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := rowMap{}
+		for i, c := range cols {
+			row[strings.ToLower(c)] = vals[i]
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// DescribeTable reads the columns, primary key, indexes and foreign keys of
+// a table. the name may be qualified with its schema (and database on mssql
+// and snowflake); unqualified names are looked up in the tenant of the
+// connection or the default schema of the session. Length is -1 for
+// unbounded columns such as NVARCHAR(MAX).
+func (c *Connection) DescribeTable(name string) (*Table, error) {
+	ref, err := c.tableRef(name)
+	if err != nil {
+		return nil, err
+	}
+	db := c.writer()
+	ctx := context.Background()
+	rows, err := db.queryMaps(ctx, ref.columnsSQL())
+	if err != nil {
+		return nil, errors.Wrapf(err, "describe %s", name)
+	}
+	if len(rows) == 0 {
+		return nil, errors.Wrap(ErrNoTable, name)
+	}
+	t := &Table{Schema: rows[0].str("table_schema"), Name: ref.name}
+	for _, row := range rows {
+		t.Columns = append(t.Columns, &Column{
+			Name:       row.str("column_name"),
+			DataType:   strings.ToUpper(row.str("data_type")),
+			Length:     row.int("character_maximum_length"),
+			Nullable:   row.bool("is_nullable"),
+			Default:    nulls.String(row["column_default"]),
+			Precision:  row.int("numeric_precision"),
+			Scale:      row.int("numeric_scale"),
+			Identity:   row.bool("is_identity"),
+			Generated:  row.bool("is_generated"),
+			ColumnType: row.str("column_type"),
+			Extra:      row.str("extra"),
+			Comment:    row.str("column_comment"),
+			Collation:  row.str("collation_name"),
+		})
+	}
+	if err := c.describeKeys(ctx, db, ref, t); err != nil {
+		return nil, errors.Wrapf(err, "describe %s", name)
+	}
+	if stmt := ref.indexesSQL(); stmt != "" {
+		rows, err := db.queryMaps(ctx, stmt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "describe %s", name)
+		}
+		var idx *Index
+		for _, row := range rows {
+			if idx == nil || idx.Name != row.str("index_name") {
+				idx = &Index{Name: row.str("index_name"), Unique: row.bool("is_unique")}
+				t.Indexes = append(t.Indexes, idx)
+			}
+			idx.Columns = append(idx.Columns, row.str("column_name"))
+		}
+	}
+	return t, nil
+}
+
+// describeKeys reads the primary and foreign keys of a table
+func (c *Connection) describeKeys(ctx context.Context, db *DB, ref *tableRef, t *Table) error {
+	var fk *ForeignKey
+	addFK := func(name, col, refTable, refCol string) {
+		if fk == nil || fk.Name != name {
+			fk = &ForeignKey{Name: name, RefTable: refTable}
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		fk.Columns = append(fk.Columns, col)
+		fk.RefColumns = append(fk.RefColumns, refCol)
+	}
+	stmts := ref.keysSQL()
+	if ref.dialect == "snowflake" {
+		rows, err := db.queryMaps(ctx, stmts[0])
+		if err != nil {
+			return err
+		}
+		sortKeys(rows, "constraint_name")
+		for _, row := range rows {
+			t.PrimaryKey = append(t.PrimaryKey, row.str("column_name"))
+		}
+		if rows, err = db.queryMaps(ctx, stmts[1]); err != nil {
+			return err
+		}
+		sortKeys(rows, "fk_name")
+		for _, row := range rows {
+			addFK(row.str("fk_name"), row.str("fk_column_name"), row.str("pk_table_name"), row.str("pk_column_name"))
+		}
+		return nil
+	}
+	rows, err := db.queryMaps(ctx, stmts[0])
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.str("constraint_type") == "PRIMARY KEY" {
+			t.PrimaryKey = append(t.PrimaryKey, row.str("column_name"))
+			continue
+		}
+		addFK(row.str("constraint_name"), row.str("column_name"), row.str("ref_table"), row.str("ref_column"))
+	}
+	return nil
+}
+
+// sortKeys orders the rows of a snowflake SHOW ... KEYS by constraint and
+// position, which the output is not guaranteed to be
+func sortKeys(rows []rowMap, name string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if a, b := rows[i].str(name), rows[j].str(name); a != b {
+			return a < b
+		}
+		return rows[i].int("key_sequence") < rows[j].int("key_sequence")
+	})
+}
+
+// ListTables lists the base tables of the tenant of the connection or of
+// the default schema of the session
+func (c *Connection) ListTables() ([]string, error) {
+	ref, err := c.tableRef("")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.writer().queryMaps(context.Background(), ref.tablesSQL())
+	if err != nil {
+		return nil, errors.Wrap(err, "list tables")
+	}
+	names := []string{}
+	for _, row := range rows {
+		names = append(names, row.str("table_name"))
+	}
+	return names, nil
+}
@@ -0,0 +1,114 @@
+package dasorm
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/estenssoros/dasorm/nulls"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// describeResponder answers the introspection queries for a users table
+func describeResponder(query string) ([]string, [][]driver.Value) {
+	switch {
+	case strings.Contains(query, "information_schema.columns"):
+		return []string{"TABLE_SCHEMA", "COLUMN_NAME", "DATA_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "CHARACTER_MAXIMUM_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE"},
+			[][]driver.Value{
+				{"public", "id", "uuid", "NO", nil, nil, nil, nil},
+				{"public", "email", "character varying", "NO", nil, int64(120), nil, nil},
+				{"public", "org_id", "bigint", "YES", "0", nil, int64(64), int64(0)},
+			}
+	case strings.Contains(query, "pg_constraint"):
+		return []string{"constraint_name", "constraint_type", "column_name", "ref_table", "ref_column"},
+			[][]driver.Value{
+				{"orgs_fk", "FOREIGN KEY", "org_id", "orgs", "id"},
+				{"users_pkey", "PRIMARY KEY", "id", nil, nil},
+			}
+	case strings.Contains(query, "pg_index"):
+		return []string{"index_name", "is_unique", "column_name"},
+			[][]driver.Value{
+				{"users_email_key", true, "email"},
+				{"users_org", false, "org_id"},
+				{"users_org", false, "email"},
+			}
+	case strings.Contains(query, "information_schema.tables"):
+		return []string{"table_name"}, [][]driver.Value{{"orgs"}, {"users"}}
+	}
+	return nil, nil
+}
+
+func TestDescribeTable(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	fake.respond = describeResponder
+	table, err := conn.DescribeTable("users")
+	assert.NoError(t, err)
+	assert.Equal(t, "public", table.Schema)
+	assert.Equal(t, []*Column{
+		{Name: "id", DataType: "UUID"},
+		{Name: "email", DataType: "CHARACTER VARYING", Length: 120},
+		{Name: "org_id", DataType: "BIGINT", Nullable: true, Default: nulls.NewString("0"), Precision: 64},
+	}, table.Columns)
+	assert.Equal(t, []string{"id"}, table.PrimaryKey)
+	assert.Equal(t, []*ForeignKey{{Name: "orgs_fk", Columns: []string{"org_id"}, RefTable: "orgs", RefColumns: []string{"id"}}}, table.ForeignKeys)
+	assert.Equal(t, []*Index{
+		{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+		{Name: "users_org", Columns: []string{"org_id", "email"}},
+	}, table.Indexes)
+	assert.Equal(t, "org_id", table.Column("ORG_ID").Name)
+	assert.Contains(t, fake.Statements()[0], "WHERE table_schema = current_schema() AND table_name = 'users'")
+	assert.Contains(t, fake.Statements()[0], "is_identity, CASE is_generated WHEN 'ALWAYS'")
+
+	tables, err := conn.ListTables()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orgs", "users"}, tables)
+
+	fake.respond = func(string) ([]string, [][]driver.Value) { return nil, nil }
+	_, err = conn.DescribeTable("nope")
+	assert.EqualError(t, err, "nope: table does not exist")
+	assert.Equal(t, ErrNoTable, errors.Cause(err))
+	_, err = conn.DescribeTable("users; DROP TABLE users")
+	assert.EqualError(t, err, `invalid table name "users; DROP TABLE users"`)
+}
+
+func TestTableRef(t *testing.T) {
+	conn, fake := newFakeConnection(t, "snowflake")
+	tenant, err := conn.WithDatabase("analytics")
+	assert.NoError(t, err)
+	tenant, err = tenant.WithSchema("acme")
+	assert.NoError(t, err)
+	ref, err := tenant.tableRef("users")
+	assert.NoError(t, err)
+	assert.Equal(t, &tableRef{dialect: "snowflake", catalog: "ANALYTICS", schema: "ACME", name: "USERS"}, ref)
+	assert.Contains(t, ref.columnsSQL(), "FROM ANALYTICS.information_schema.columns\nWHERE table_schema = 'ACME' AND table_name = 'USERS'")
+
+	fake.respond = func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SHOW PRIMARY KEYS") {
+			return []string{"constraint_name", "column_name", "key_sequence"}, [][]driver.Value{{"pk", "B", int64(2)}, {"pk", "A", int64(1)}}
+		}
+		return describeResponder(query)
+	}
+	table, err := tenant.DescribeTable("users")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"A", "B"}, table.PrimaryKey)
+	assert.Contains(t, fake.Statements(), "SHOW IMPORTED KEYS IN TABLE ANALYTICS.ACME.USERS")
+
+	mssql, _ := newFakeConnection(t, "mssql")
+	ref, err = mssql.tableRef("")
+	assert.NoError(t, err)
+	assert.Contains(t, ref.tablesSQL(), "WHERE table_schema = SCHEMA_NAME() AND table_type = 'BASE TABLE'")
+	ref, err = mssql.tableRef("sales.dbo.orders")
+	assert.NoError(t, err)
+	assert.Contains(t, ref.indexesSQL(), "FROM sales.sys.indexes i")
+	assert.Contains(t, ref.indexesSQL(), "OBJECT_ID('sales.dbo.orders')")
+	assert.Contains(t, ref.columnsSQL(), "column_name, 'IsIdentity') AS is_identity")
+
+	my, _ := newFakeConnection(t, "mysql")
+	ref, err = my.tableRef("users")
+	assert.NoError(t, err)
+	assert.Contains(t, ref.columnsSQL(), "CASE WHEN extra LIKE '%auto_increment%' THEN 1 ELSE 0 END AS is_identity")
+	assert.Contains(t, ref.columnsSQL(), "column_type, extra, column_comment, collation_name")
+	_, err = my.tableRef("a.b.c")
+	assert.EqualError(t, err, `invalid table name "a.b.c"`)
+}
@@ -0,0 +1,157 @@
+package dasorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Logger receives an entry for every statement executed through a Connection
+type Logger interface {
+	Log(entry *LogEntry)
+}
+
+// LogEntry describes a single executed statement
+type LogEntry struct {
+	Statement    string
+	Args         []interface{}
+	Duration     time.Duration
+	RowsAffected int64
+	Err          error
+	Caller       string
+	// Fingerprint is the normalized statement, set on slow query entries
+	Fingerprint string
+}
+
+// LoggerFunc adapts an ordinary function to the Logger interface
+type LoggerFunc func(*LogEntry)
+
+// Log calls f(entry)
+func (f LoggerFunc) Log(entry *LogEntry) {
+	f(entry)
+}
+
+// flattenSQL collapses a multi-line statement onto a single line
+func flattenSQL(s string) string {
+	breaks := strings.Split(s, "\n")
+	for i, b := range breaks {
+		breaks[i] = strings.TrimSpace(b)
+	}
+	return strings.Join(breaks, " ")
+}
+
+func (e *LogEntry) String() string {
+	out := fmt.Sprintf("%s (%s)", flattenSQL(e.Statement), e.Duration)
+	if len(e.Args) > 0 {
+		out += fmt.Sprintf(" args=%v", e.Args)
+	}
+	if e.RowsAffected > 0 {
+		out += fmt.Sprintf(" rows=%d", e.RowsAffected)
+	}
+	if e.Caller != "" {
+		out += " caller=" + e.Caller
+	}
+	if e.Err != nil {
+		out += " err=" + e.Err.Error()
+	}
+	return out
+}
+
+// colorLogger is used when debug is enabled and no logger has been set
+type colorLogger struct{}
+
+func (colorLogger) Log(entry *LogEntry) {
+	if entry.Err != nil {
+		color.Red(entry.String())
+		return
+	}
+	color.Green(entry.String())
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+// NewStdLogger returns a Logger that writes entries with the standard log package.
+// A nil logger writes to the log package's standard logger.
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{logger: l}
+}
+
+func (s *stdLogger) Log(entry *LogEntry) {
+	if s.logger == nil {
+		log.Print("[dasorm] " + entry.String())
+		return
+	}
+	s.logger.Print("[dasorm] " + entry.String())
+}
+
+type jsonLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLogger returns a Logger that writes one JSON object per line to w
+func NewJSONLogger(w io.Writer) Logger {
+	return &jsonLogger{w: w}
+}
+
+type jsonEntry struct {
+	Time         time.Time     `json:"time"`
+	Statement    string        `json:"statement"`
+	Args         []interface{} `json:"args,omitempty"`
+	DurationMS   float64       `json:"duration_ms"`
+	RowsAffected int64         `json:"rows_affected"`
+	Caller       string        `json:"caller,omitempty"`
+	Fingerprint  string        `json:"fingerprint,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+func (j *jsonLogger) Log(entry *LogEntry) {
+	out := jsonEntry{
+		Time:         time.Now().UTC(),
+		Statement:    flattenSQL(entry.Statement),
+		Args:         entry.Args,
+		DurationMS:   float64(entry.Duration) / float64(time.Millisecond),
+		RowsAffected: entry.RowsAffected,
+		Caller:       entry.Caller,
+		Fingerprint:  entry.Fingerprint,
+	}
+	if entry.Err != nil {
+		out.Error = entry.Err.Error()
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		out.Args = nil
+		out.Error = fmt.Sprintf("marshal args: %v", err)
+		b, _ = json.Marshal(out)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w.Write(append(b, '\n'))
+}
+
+var packagePrefix = "github.com/estenssoros/dasorm."
+
+// callerSite finds the first stack frame outside of this package
+func callerSite() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePrefix) || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
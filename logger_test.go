@@ -0,0 +1,52 @@
+package dasorm
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger(buf)
+	l.Log(&LogEntry{
+		Statement:    "SELECT *\n  FROM test",
+		Args:         []interface{}{1, "asdf"},
+		Duration:     1500 * time.Microsecond,
+		RowsAffected: 2,
+		Err:          errors.New("boom"),
+		Caller:       "main.go:10",
+	})
+	have := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "SELECT * FROM test", have["statement"])
+	assert.Equal(t, []interface{}{1.0, "asdf"}, have["args"])
+	assert.Equal(t, 1.5, have["duration_ms"])
+	assert.Equal(t, 2.0, have["rows_affected"])
+	assert.Equal(t, "main.go:10", have["caller"])
+	assert.Equal(t, "boom", have["error"])
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+}
+
+func TestStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewStdLogger(log.New(buf, "", 0))
+	l.Log(&LogEntry{Statement: "SELECT 1", Args: []interface{}{7}, Duration: time.Second})
+	assert.Equal(t, "[dasorm] SELECT 1 (1s) args=[7]\n", buf.String())
+}
+
+func TestCallerSite(t *testing.T) {
+	var have string
+	func() {
+		have = callerSite()
+	}()
+	assert.Contains(t, have, "logger_test.go")
+}
@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	"github.com/pkg/errors"
+)
+
+// DiffName is the name of the migrations made by Diff
+const DiffName = "diff"
+
+// versionFormat versions generated migrations with the time they are made
+const versionFormat = "20060102150405"
+
+// Diff compares models with their live tables and returns a migration that
+// brings the tables in line with them, see dasorm.Connection.AlterTableStmts,
+// and a down migration undoing it, or nil when nothing differs. it is
+// versioned with the current time and meant to be reviewed and written with
+// Write rather than applied as is.
+//
+//	m, err := migrate.Diff(conn, &User{}, &Order{})
+//	if m != nil {
+//		m.Name = "add_user_email"
+//		err = migrate.Write("migrations", m)
+//	}
+func Diff(conn *dasorm.Connection, models ...interface{}) (*Migration, error) {
+	var up, down []string
+	for _, model := range models {
+		u, d, err := conn.AlterTableStmts(model)
+		if err != nil {
+			return nil, err
+		}
+		up = append(up, u...)
+		down = append(d, down...)
+	}
+	if len(up) == 0 {
+		return nil, nil
+	}
+	version, err := strconv.ParseInt(time.Now().UTC().Format(versionFormat), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &Migration{Version: version, Name: DiffName, Up: sqlFile(up), Down: sqlFile(down)}, nil
+}
+
+// sqlFile joins statements into the body of a migration file
+func sqlFile(stmts []string) string {
+	return strings.Join(stmts, ";\n\n") + ";\n"
+}
+
+// Write writes the up and down files of a migration to a directory. existing
+// files are not overwritten and no file is left behind when one of them
+// cannot be written.
+func Write(dir string, m *Migration) (err error) {
+	if !fileName.MatchString(fmt.Sprintf("%d_%s.up.sql", m.Version, m.Name)) || strings.ContainsAny(m.Name, `/\`) {
+		return errors.Errorf("invalid migration name %q", m.Name)
+	}
+	written := []string{}
+	defer func() {
+		if err != nil {
+			for _, path := range written {
+				os.Remove(path)
+			}
+		}
+	}()
+	for _, direction := range []string{"up", "down"} {
+		body := m.Up
+		if direction == "down" {
+			body = m.Down
+		}
+		if body == "" {
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%d_%s.%s.sql", m.Version, m.Name, direction))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return errors.Wrap(err, "write migration")
+		}
+		written = append(written, path)
+		if _, err := f.WriteString(body); err != nil {
+			f.Close()
+			return errors.Wrap(err, "write migration")
+		}
+		if err := f.Close(); err != nil {
+			return errors.Wrap(err, "write migration")
+		}
+	}
+	return nil
+}
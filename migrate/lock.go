@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lockRetry is how often a table lock is retried while it is held elsewhere
+var lockRetry = time.Second
+
+// lock takes the migration lock of the dialect on the session and returns
+// the function that releases it: an advisory lock on postgres, a named lock
+// on mysql, an application lock on mssql and a row of a lock table on
+// snowflake and any other dialect.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, m.lockTimeout())
+	defer cancel()
+	name := "dasorm_" + m.table()
+	var (
+		acquire func() error
+		release string
+	)
+	switch m.conn.DialectName() {
+	case "postgres":
+		key := lockKey(name)
+		acquire = func() error {
+			_, err := m.conn.ExecOn(ctx, conn, fmt.Sprintf("SELECT pg_advisory_lock(%d)", key))
+			return err
+		}
+		release = fmt.Sprintf("SELECT pg_advisory_unlock(%d)", key)
+	case "mysql":
+		acquire = func() error {
+			var ok sql.NullInt64
+			stmt := fmt.Sprintf("SELECT GET_LOCK('%s', %d)", name, int(m.lockTimeout().Seconds()))
+			if err := m.scan(ctx, conn, stmt, &ok); err != nil {
+				return err
+			}
+			if ok.Int64 != 1 {
+				return errors.New("lock is held by another migration")
+			}
+			return nil
+		}
+		release = fmt.Sprintf("SELECT RELEASE_LOCK('%s')", name)
+	case "mssql":
+		acquire = func() error {
+			var res int
+			stmt := fmt.Sprintf("DECLARE @r int; EXEC @r = sp_getapplock @Resource = '%s', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = %d; SELECT @r",
+				name, m.lockTimeout().Milliseconds())
+			if err := m.scan(ctx, conn, stmt, &res); err != nil {
+				return err
+			}
+			if res < 0 {
+				return errors.New("lock is held by another migration")
+			}
+			return nil
+		}
+		release = fmt.Sprintf("EXEC sp_releaseapplock @Resource = '%s', @LockOwner = 'Session'", name)
+	default:
+		table := m.table() + "_lock"
+		acquire = func() error { return m.lockTable(ctx, conn, table) }
+		release = fmt.Sprintf("UPDATE %s SET locked = FALSE", table)
+	}
+	if err := acquire(); err != nil {
+		return nil, errors.Wrap(err, "migration lock")
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		m.conn.ExecOn(ctx, conn, release)
+	}, nil
+}
+
+// lockTable takes the lock by flipping the single row of a lock table, for
+// databases without advisory locks. a process that dies holding the lock
+// leaves it taken until the row is updated by hand.
+func (m *Migrator) lockTable(ctx context.Context, conn *sql.Conn, table string) error {
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id INT NOT NULL, locked BOOLEAN NOT NULL, locked_at TIMESTAMP)", table),
+		fmt.Sprintf("INSERT INTO %s (id, locked) SELECT 1, FALSE WHERE NOT EXISTS (SELECT 1 FROM %s)", table, table),
+	} {
+		if _, err := m.conn.ExecOn(ctx, conn, stmt); err != nil {
+			return err
+		}
+	}
+	stmt := fmt.Sprintf("UPDATE %s SET locked = TRUE, locked_at = CURRENT_TIMESTAMP WHERE locked = FALSE", table)
+	for {
+		res, err := m.conn.ExecOn(ctx, conn, stmt)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "lock is held by another migration")
+		case <-time.After(lockRetry):
+		}
+	}
+}
+
+// scan reads the single value returned by a statement on the session
+func (m *Migrator) scan(ctx context.Context, conn *sql.Conn, stmt string, dest interface{}) error {
+	rows, err := m.conn.QueryOn(ctx, conn, stmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	return rows.Scan(dest)
+}
+
+// lockKey hashes a lock name to a postgres advisory lock key
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
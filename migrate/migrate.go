@@ -0,0 +1,319 @@
+// Package migrate applies versioned sql migrations through a dasorm connection
+//
+//	m, err := migrate.NewDir(conn, "migrations")
+//	err = m.Up(ctx)
+//
+// migrations can also be embedded: migrate.New(conn, migrationsFS) takes any
+// fs.FS, such as an embed.FS (use fs.Sub for a subdirectory).
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	"github.com/pkg/errors"
+)
+
+// DefaultTable records the applied versions
+const DefaultTable = "schema_migrations"
+
+// DefaultLockTimeout is how long a run waits for another one to finish
+const DefaultLockTimeout = time.Minute
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Migrator applies migrations to a connection. runs take a lock so that
+// concurrent runs, e.g. from several instances of a service starting at once,
+// apply each migration once.
+type Migrator struct {
+	// Table records the applied versions. defaults to DefaultTable
+	Table string
+	// LockTimeout defaults to DefaultLockTimeout
+	LockTimeout time.Duration
+
+	conn       *dasorm.Connection
+	migrations []*Migration
+}
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Missing is set for applied versions that have no migration file
+	Missing bool
+}
+
+// New returns a migrator for the migrations in the root of fsys
+func New(conn *dasorm.Connection, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+// NewDir returns a migrator for the migrations in a directory
+func NewDir(conn *dasorm.Connection, dir string) (*Migrator, error) {
+	return New(conn, os.DirFS(dir))
+}
+
+// Migrations returns the known migrations sorted by version
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+func (m *Migrator) table() string {
+	if m.Table == "" {
+		return DefaultTable
+	}
+	return m.Table
+}
+
+// validTable checks the table name, which is used in statements unquoted
+func (m *Migrator) validTable() error {
+	if !tableName.MatchString(m.table()) {
+		return errors.Errorf("invalid migrations table %q", m.table())
+	}
+	return nil
+}
+
+func (m *Migrator) lockTimeout() time.Duration {
+	if m.LockTimeout <= 0 {
+		return DefaultLockTimeout
+	}
+	return m.LockTimeout
+}
+
+// Up applies every pending migration in version order
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, func(applied map[int64]Status) ([]step, error) {
+		return m.pending(applied, -1), nil
+	})
+}
+
+// Down rolls back the n latest applied migrations
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.run(ctx, func(applied map[int64]Status) ([]step, error) {
+		return m.rollbacks(applied, n, -1)
+	})
+}
+
+// To migrates up or down to a version: pending migrations up to it are
+// applied and applied ones after it rolled back. version 0 rolls back
+// everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version > 0 && m.find(version) == nil {
+		return errors.Errorf("unknown migration version %d", version)
+	}
+	return m.run(ctx, func(applied map[int64]Status) ([]step, error) {
+		steps, err := m.rollbacks(applied, -1, version)
+		if err != nil {
+			return nil, err
+		}
+		return append(steps, m.pending(applied, version)...), nil
+	})
+}
+
+// Status lists the migrations and the applied versions without a file. it
+// only reads: without a migrations table nothing is applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.validTable(); err != nil {
+		return nil, err
+	}
+	if _, err := m.conn.DescribeTable(m.table()); errors.Cause(err) == dasorm.ErrNoTable {
+		return m.status(nil), nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "read applied migrations")
+	}
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+func (m *Migrator) status(applied map[int64]Status) []Status {
+	out := []Status{}
+	known := map[int64]bool{}
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+		}
+		out = append(out, s)
+	}
+	for version, a := range applied {
+		if !known[version] {
+			a.Missing = true
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+// step is a migration to apply or roll back
+type step struct {
+	migration *Migration
+	down      bool
+}
+
+// pending returns the migrations to apply, up to version unless it is negative
+func (m *Migrator) pending(applied map[int64]Status, version int64) []step {
+	steps := []step{}
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok || (version >= 0 && mig.Version > version) {
+			continue
+		}
+		steps = append(steps, step{migration: mig})
+	}
+	return steps
+}
+
+// rollbacks returns the n latest applied migrations, or the ones after
+// version when n is negative, latest first
+func (m *Migrator) rollbacks(applied map[int64]Status, n int, version int64) ([]step, error) {
+	statuses := m.status(applied)
+	steps := []step{}
+	for i := len(statuses) - 1; i >= 0 && n != 0; i-- {
+		s := statuses[i]
+		if !s.Applied && !s.Missing {
+			continue
+		}
+		if n < 0 && s.Version <= version {
+			break
+		}
+		mig := m.find(s.Version)
+		if mig == nil {
+			return nil, errors.Errorf("applied version %d has no migration file", s.Version)
+		}
+		if strings.TrimSpace(mig.Down) == "" {
+			return nil, errors.Errorf("%d_%s has no down migration", mig.Version, mig.Name)
+		}
+		steps = append(steps, step{migration: mig, down: true})
+		n--
+	}
+	return steps, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return nil
+}
+
+// run plans and applies steps on one session holding the migration lock
+func (m *Migrator) run(ctx context.Context, plan func(applied map[int64]Status) ([]step, error)) error {
+	if err := m.validTable(); err != nil {
+		return err
+	}
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	steps, err := plan(applied)
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		if err := m.apply(ctx, conn, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs a step and records it in one transaction. mysql and snowflake
+// commit ddl right away, so the transaction makes no migration with ddl
+// atomic there: a failed one may be partly applied and its record missing.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, s step) error {
+	mig := s.migration
+	body, direction := mig.Up, "up"
+	record := fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (%d, %s, CURRENT_TIMESTAMP)", m.table(), mig.Version, quote(mig.Name))
+	if s.down {
+		body, direction = mig.Down, "down"
+		record = fmt.Sprintf("DELETE FROM %s WHERE version = %d", m.table(), mig.Version)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range append(split(body), record) {
+		if _, err := m.conn.ExecOn(ctx, tx, stmt); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "%d_%s %s", mig.Version, mig.Name, direction)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "%d_%s %s", mig.Version, mig.Name, direction)
+	}
+	log.Printf("[dasorm] migrate %s %d_%s", direction, mig.Version, mig.Name)
+	return nil
+}
+
+// createTable creates the versions table if it does not exist
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL)", m.table())
+	if m.conn.DialectName() == "mssql" {
+		stmt = fmt.Sprintf("IF OBJECT_ID(%s, 'U') IS NULL CREATE TABLE %s (version BIGINT NOT NULL PRIMARY KEY, name NVARCHAR(255) NOT NULL, applied_at DATETIME2 NOT NULL)",
+			quote(m.table()), m.table())
+	}
+	_, err := m.conn.ExecOn(ctx, conn, stmt)
+	return errors.Wrap(err, "create migrations table")
+}
+
+// applied reads the applied versions
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]Status, error) {
+	rows, err := m.conn.QueryOn(ctx, conn, fmt.Sprintf("SELECT version, name, applied_at FROM %s ORDER BY version", m.table()))
+	if err != nil {
+		return nil, errors.Wrap(err, "read applied migrations")
+	}
+	defer rows.Close()
+	applied := map[int64]Status{}
+	for rows.Next() {
+		s := Status{Applied: true}
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, errors.Wrap(err, "read applied migrations")
+		}
+		applied[s.Version] = s
+	}
+	return applied, errors.Wrap(rows.Err(), "read applied migrations")
+}
+
+// quote returns s as a sql string literal
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,289 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/estenssoros/dasorm"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDB keeps the versions table of a database and records statements
+type fakeDB struct {
+	mu       sync.Mutex
+	stmts    []string
+	versions map[int64]string
+	// table is set once the versions table is created
+	table bool
+}
+
+var (
+	insertVersion = regexp.MustCompile(`^INSERT INTO schema_migrations .* VALUES \((\d+), '(.*)', CURRENT_TIMESTAMP\)$`)
+	deleteVersion = regexp.MustCompile(`^DELETE FROM schema_migrations WHERE version = (\d+)$`)
+
+	fakesMu sync.Mutex
+	fakes   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("migrate_fake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakesMu.Lock()
+	defer fakesMu.Unlock()
+	return &fakeConn{db: fakes[name]}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.stmts = append(c.db.stmts, query)
+	if strings.Contains(query, "broken") {
+		return nil, fmt.Errorf("syntax error")
+	}
+	if strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations") {
+		c.db.table = true
+	}
+	if m := insertVersion.FindStringSubmatch(query); m != nil {
+		v, _ := strconv.ParseInt(m[1], 10, 64)
+		c.db.versions[v] = strings.Replace(m[2], "''", "'", -1)
+	}
+	if m := deleteVersion.FindStringSubmatch(query); m != nil {
+		v, _ := strconv.ParseInt(m[1], 10, 64)
+		delete(c.db.versions, v)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.stmts = append(c.db.stmts, query)
+	if strings.HasPrefix(query, "SELECT GET_LOCK") {
+		return &fakeRows{columns: []string{"lock"}, rows: [][]driver.Value{{int64(1)}}}, nil
+	}
+	if strings.Contains(query, "information_schema") {
+		rows := &fakeRows{columns: []string{"table_schema", "column_name"}}
+		if c.db.table && strings.Contains(query, "schema_migrations") {
+			rows.rows = [][]driver.Value{{"app", "version"}}
+		}
+		return rows, nil
+	}
+	rows := &fakeRows{columns: []string{"version", "name", "applied_at"}}
+	versions := []int64{}
+	for v := range c.db.versions {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, v := range versions {
+		rows.rows = append(rows.rows, []driver.Value{v, c.db.versions[v], time.Now()})
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+func newMigrator(t *testing.T, files fstest.MapFS) (*Migrator, *fakeDB) {
+	fake := &fakeDB{versions: map[int64]string{}}
+	fakesMu.Lock()
+	fakes[t.Name()] = fake
+	fakesMu.Unlock()
+	db, err := sql.Open("migrate_fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(dasorm.MockDB(db, "mysql"), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, fake
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+var testFiles = fstest.MapFS{
+	"1_users.up.sql":      file("CREATE TABLE users (id INT);\nCREATE INDEX users_id ON users (id);"),
+	"1_users.down.sql":    file("DROP TABLE users;"),
+	"2_orders.up.sql":     file("CREATE TABLE orders (id INT);"),
+	"2_orders.down.sql":   file("DROP TABLE orders;"),
+	"10_o'brien.up.sql":   file("INSERT INTO users VALUES (1);"),
+	"10_o'brien.down.sql": file("DELETE FROM users;"),
+	"README.md":           file("ignored"),
+}
+
+func TestUpDown(t *testing.T) {
+	m, fake := newMigrator(t, testFiles)
+	logged := []string{}
+	m.conn.SetLogger(dasorm.LoggerFunc(func(e *dasorm.LogEntry) {
+		logged = append(logged, e.Statement)
+	}))
+	ctx := context.Background()
+	assert.NoError(t, m.Up(ctx))
+	assert.Equal(t, map[int64]string{1: "users", 2: "orders", 10: "o'brien"}, fake.versions)
+	assert.Equal(t, "SELECT GET_LOCK('dasorm_schema_migrations', 60)", fake.stmts[0])
+	assert.Contains(t, fake.stmts, "CREATE INDEX users_id ON users (id)")
+	assert.Equal(t, "SELECT RELEASE_LOCK('dasorm_schema_migrations')", fake.stmts[len(fake.stmts)-1])
+	assert.Equal(t, fake.stmts, logged, "migration statements reach the logger")
+
+	n := len(fake.stmts)
+	assert.NoError(t, m.Up(ctx))
+	assert.Len(t, fake.stmts, n+4) // lock, create table, read versions, unlock
+
+	assert.NoError(t, m.Down(ctx, 2))
+	assert.Equal(t, map[int64]string{1: "users"}, fake.versions)
+
+	assert.NoError(t, m.To(ctx, 2))
+	assert.Equal(t, map[int64]string{1: "users", 2: "orders"}, fake.versions)
+	assert.NoError(t, m.To(ctx, 0))
+	assert.Empty(t, fake.versions)
+	assert.EqualError(t, m.To(ctx, 3), "unknown migration version 3")
+
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, status, 3)
+	assert.False(t, status[0].Applied)
+}
+
+func TestStatusAndFailures(t *testing.T) {
+	m, fake := newMigrator(t, fstest.MapFS{
+		"1_a.up.sql": file("CREATE TABLE a (id INT);"),
+		"2_b.up.sql": file("CREATE broken;"),
+	})
+	ctx := context.Background()
+	status, err := m.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, status, 2)
+	assert.False(t, status[0].Applied || status[1].Applied)
+	for _, stmt := range fake.stmts {
+		assert.NotContains(t, stmt, "CREATE", "status creates no table")
+	}
+
+	fake.versions[7] = "gone"
+	err = m.Up(ctx)
+	assert.EqualError(t, err, "2_b up: syntax error")
+
+	status, err = m.Status(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 7}, []int64{status[0].Version, status[1].Version, status[2].Version})
+	assert.True(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+	assert.True(t, status[2].Missing)
+
+	assert.EqualError(t, m.Down(ctx, 1), "applied version 7 has no migration file")
+	delete(fake.versions, 7)
+	assert.EqualError(t, m.Down(ctx, 1), "1_a has no down migration")
+
+	m.Table = "bad name"
+	assert.Error(t, m.Up(ctx))
+}
+
+func TestLoad(t *testing.T) {
+	_, err := Load(fstest.MapFS{"1_a.up.sql": file("x"), "1_b.down.sql": file("y")})
+	assert.EqualError(t, err, "version 1 is used by a and b")
+	_, err = Load(fstest.MapFS{"1_a.down.sql": file("y")})
+	assert.EqualError(t, err, "1_a has no up migration")
+}
+
+func TestSplit(t *testing.T) {
+	sql := `-- create things
+CREATE TABLE a (s TEXT DEFAULT ';');
+INSERT INTO a VALUES ('it''s; fine'); /* ; */
+CREATE FUNCTION f() RETURNS void AS $$ BEGIN PERFORM 1; END; $$ LANGUAGE plpgsql;
+-- trailing comment`
+	assert.Equal(t, []string{
+		"-- create things\nCREATE TABLE a (s TEXT DEFAULT ';')",
+		"INSERT INTO a VALUES ('it''s; fine')",
+		"/* ; */\nCREATE FUNCTION f() RETURNS void AS $$ BEGIN PERFORM 1; END; $$ LANGUAGE plpgsql",
+	}, split(sql))
+
+	batches := "CREATE TABLE a (id INT);\nINSERT INTO a VALUES ('\nGO\n');\ngo\n  GO  \r\nCREATE PROCEDURE p AS BEGIN SELECT 1; SELECT 2; END\n-- GO\nGO"
+	assert.Equal(t, []string{
+		"CREATE TABLE a (id INT);\nINSERT INTO a VALUES ('\nGO\n');",
+		"CREATE PROCEDURE p AS BEGIN SELECT 1; SELECT 2; END\n-- GO",
+	}, split(batches), "sql server batches run whole")
+
+	whole := "-- dasorm:no-split\nCREATE PROCEDURE p AS BEGIN SELECT 1; SELECT 2; END"
+	assert.Equal(t, []string{whole}, split(whole))
+}
+
+type diffUser struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+func (diffUser) TableName() string { return "users" }
+
+func TestDiffWrite(t *testing.T) {
+	m, _ := newMigrator(t, fstest.MapFS{})
+	// the fake database has no tables, so the diff creates them
+	mig, err := Diff(m.conn, &diffUser{})
+	assert.NoError(t, err)
+	assert.Equal(t, DiffName, mig.Name)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `users` (\n  `id` BIGINT NOT NULL,\n  `name` VARCHAR(255) NOT NULL,\n  PRIMARY KEY (`id`)\n);\n", mig.Up)
+	assert.Equal(t, "DROP TABLE `users`;\n", mig.Down)
+
+	dir := t.TempDir()
+	mig.Version, mig.Name = 20240101120000, "create_users"
+	assert.NoError(t, Write(dir, mig))
+	loaded, err := Load(os.DirFS(dir))
+	assert.NoError(t, err)
+	assert.Equal(t, []*Migration{mig}, loaded)
+	assert.Error(t, Write(dir, mig))
+
+	// a down file in the way leaves no up file behind
+	mig.Version = 20240101120001
+	down := filepath.Join(dir, "20240101120001_create_users.down.sql")
+	assert.NoError(t, os.WriteFile(down, []byte("SELECT 1;\n"), 0644))
+	assert.Error(t, Write(dir, mig))
+	_, err = os.Stat(filepath.Join(dir, "20240101120001_create_users.up.sql"))
+	assert.True(t, os.IsNotExist(err))
+
+	mig.Name = "../escape"
+	assert.EqualError(t, Write(dir, mig), `invalid migration name "../escape"`)
+}
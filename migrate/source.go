@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fileName matches <version>_<name>.up.sql and <version>_<name>.down.sql
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// noSplit at the top of a file runs it as a single statement. files using
+// the mysql client's DELIMITER command need it: DELIMITER is not sql and is
+// not understood, so such a file must hold the body of a single routine or
+// trigger without it.
+const noSplit = "-- dasorm:no-split"
+
+// batchSeparator is a sql server GO line, which ends a batch
+var batchSeparator = regexp.MustCompile(`(?i)^[ \t]*GO[ \t]*(\r?\n|$)`)
+
+// Migration is one version of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads the migrations in the root of fsys, sorted by version. files
+// are named <version>_<name>.up.sql and <version>_<name>.down.sql; the down
+// file is optional and other files are ignored.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "read migrations")
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, errors.Wrap(err, e.Name())
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, errors.Errorf("version %d is used by %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, errors.Errorf("%d_%s has no up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// split breaks sql into statements on the semicolons outside of quotes,
+// comments and postgres dollar quoted bodies. a file with sql server GO lines
+// is broken into the batches between them instead, each run whole.
+func split(sql string) []string {
+	if strings.HasPrefix(strings.TrimSpace(sql), noSplit) {
+		return []string{sql}
+	}
+	stmts, batches := []string{}, []string{}
+	start, batchStart := 0, 0
+	add := func(out *[]string, from, end int) {
+		if s := strings.TrimSpace(sql[from:end]); s != "" && !onlyComments(s) {
+			*out = append(*out, s)
+		}
+	}
+	for i := 0; i < len(sql); i++ {
+		if i == 0 || sql[i-1] == '\n' {
+			if sep := batchSeparator.FindString(sql[i:]); sep != "" {
+				add(&batches, batchStart, i)
+				i += len(sep) - 1
+				start, batchStart = i+1, i+1
+				continue
+			}
+		}
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(sql, i, c)
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			i = skipTo(sql, i, "\n")
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipTo(sql, i+2, "*/") + 1
+		case c == '$':
+			if tag := dollarTag(sql[i:]); tag != "" {
+				i = skipTo(sql, i+len(tag), tag) + len(tag) - 1
+			}
+		case c == ';':
+			add(&stmts, start, i)
+			start = i + 1
+		}
+	}
+	if batchStart == 0 {
+		add(&stmts, start, len(sql))
+		return stmts
+	}
+	add(&batches, batchStart, len(sql))
+	return batches
+}
+
+// skipQuoted returns the index of the quote closing the one at i. doubled
+// quotes are escapes.
+func skipQuoted(sql string, i int, q byte) int {
+	for j := i + 1; j < len(sql); j++ {
+		if sql[j] == '\\' && q != '`' {
+			j++
+			continue
+		}
+		if sql[j] == q {
+			if j+1 < len(sql) && sql[j+1] == q {
+				j++
+				continue
+			}
+			return j
+		}
+	}
+	return len(sql)
+}
+
+// skipTo returns the index of the next end at or after i, or the end of sql
+func skipTo(sql string, i int, end string) int {
+	if i >= len(sql) {
+		return len(sql)
+	}
+	n := strings.Index(sql[i:], end)
+	if n < 0 {
+		return len(sql)
+	}
+	return i + n
+}
+
+var dollarQuote = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarTag returns the $tag$ opening a postgres dollar quoted string
+func dollarTag(s string) string {
+	return dollarQuote.FindString(s)
+}
+
+func onlyComments(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
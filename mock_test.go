@@ -0,0 +1,150 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is an in memory database/sql driver that records statements
+type fakeDB struct {
+	mu      sync.Mutex
+	stmts   []string
+	columns []string
+	rows    [][]driver.Value
+	err     error
+	delay   time.Duration
+	// pingDelay slows down pings
+	pingDelay time.Duration
+	// respond, if set, returns the result of each query instead of columns
+	// and rows
+	respond func(query string) ([]string, [][]driver.Value)
+}
+
+func (f *fakeDB) Statements() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.stmts...)
+}
+
+func (f *fakeDB) record(ctx context.Context, query string) error {
+	f.mu.Lock()
+	f.stmts = append(f.stmts, query)
+	delay, err := f.delay, f.err
+	f.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("dasorm_fake", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	db, ok := fakeDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake db %s", name)
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	c.db.mu.Lock()
+	delay := c.db.pingDelay
+	c.db.mu.Unlock()
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *fakeConn) Commit() error { return nil }
+
+func (c *fakeConn) Rollback() error { return nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.record(ctx, query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.record(ctx, query); err != nil {
+		return nil, err
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.respond != nil {
+		columns, rows := c.db.respond(query)
+		return &fakeRows{columns: columns, rows: rows}, nil
+	}
+	return &fakeRows{columns: c.db.columns, rows: c.db.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+// newFakeConnection returns a connection backed by a fresh fake database
+func newFakeConnection(t *testing.T, dialectName string) (*Connection, *fakeDB) {
+	fake := &fakeDB{}
+	name := t.Name() + dialectName + fmt.Sprint(time.Now().UnixNano())
+	fakeDBsMu.Lock()
+	fakeDBs[name] = fake
+	fakeDBsMu.Unlock()
+	db, err := sql.Open("dasorm_fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return MockDB(db, dialectName), fake
+}
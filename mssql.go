@@ -1,27 +1,46 @@
 package dasorm
 
 import (
-	"fmt"
+	"net/url"
 
 	_ "github.com/denisenkom/go-mssqldb" //mssql
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
-func connectMSSQL(creds *Config) (*Connection, error) {
-	connectionURL := fmt.Sprintf("sqlserver://%s:%s@%s?database=%s", creds.User, creds.Password, creds.Host, creds.Database)
-	db, err := sqlx.Connect("mssql", connectionURL)
+// mssqlParams maps Config.Options keys to go-mssqldb parameters
+var mssqlParams = map[string]string{
+	"encrypt":                  "encrypt",
+	"trust_server_certificate": "TrustServerCertificate",
+	"application_name":         "app name",
+	"timeout":                  "connection timeout",
+}
+
+// mssqlDSN builds the sqlserver url for a config
+func mssqlDSN(creds *Config) string {
+	query := url.Values{}
+	query.Set("database", creds.Database)
+	for _, key := range creds.sortedOptions() {
+		query.Set(mssqlParams[key], creds.Options[key])
+	}
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(creds.User, creds.Password),
+		Host:     hostPort(creds.Host, creds.Port),
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+func connectMSSQL(creds *Config) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("mssql", mssqlDSN(creds))
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxIdleConns(0)
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	return &Connection{
-		DB:      &DB{DB: db},
-		Dialect: &mssql{},
-	}, nil
+	return db, nil
 }
 
 type mssql struct{}
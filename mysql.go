@@ -1,27 +1,77 @@
 package dasorm
 
 import (
-	"fmt"
+	"strconv"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql" // mysql driver
+	mysqldriver "github.com/go-sql-driver/mysql" // mysql driver
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
-func connectMySQL(creds *Config) (*Connection, error) {
-	connectionURL := fmt.Sprintf("%s:%s@(%s)/%s?parseTime=true", creds.User, creds.Password, creds.Host, creds.Database)
+// mysqlDSN builds the go-sql-driver dsn for a config
+func mysqlDSN(creds *Config) (string, error) {
+	cfg := mysqldriver.NewConfig()
+	cfg.User = creds.User
+	cfg.Passwd = creds.Password
+	cfg.Net = "tcp"
+	cfg.Addr = hostPort(creds.Host, creds.Port)
+	cfg.DBName = creds.Database
+	cfg.ParseTime = true
+	cfg.Params = map[string]string{}
+	for _, key := range creds.sortedOptions() {
+		val := creds.Options[key]
+		switch key {
+		case "tls":
+			cfg.TLSConfig = val
+		case "charset":
+			cfg.Params["charset"] = val
+		case "collation":
+			cfg.Collation = val
+		case "timezone":
+			loc, err := time.LoadLocation(val)
+			if err != nil {
+				return "", errors.Wrap(err, "mysql timezone option")
+			}
+			cfg.Loc = loc
+		case "statement_timeout":
+			d, err := creds.statementTimeout()
+			if err != nil {
+				return "", err
+			}
+			// a session variable limiting selects, like the optimizer hint
+			cfg.Params["max_execution_time"] = strconv.FormatInt(d.Milliseconds(), 10)
+		case "timeout", "read_timeout", "write_timeout":
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return "", errors.Wrapf(err, "mysql %s option", key)
+			}
+			switch key {
+			case "timeout":
+				cfg.Timeout = d
+			case "read_timeout":
+				cfg.ReadTimeout = d
+			default:
+				cfg.WriteTimeout = d
+			}
+		}
+	}
+	return cfg.FormatDSN(), nil
+}
+
+func connectMySQL(creds *Config) (*sqlx.DB, error) {
+	connectionURL, err := mysqlDSN(creds)
+	if err != nil {
+		return nil, err
+	}
 	db, err := sqlx.Connect("mysql", connectionURL)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxIdleConns(0)
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	return &Connection{
-		DB:      &DB{DB: db},
-		Dialect: &mysql{},
-	}, nil
+	return db, nil
 }
 
 type mysql struct{}
@@ -0,0 +1,85 @@
+package dasorm
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateOptions returns an error naming every option the dialect does not
+// support, or if the dialect is not registered
+func (c *Config) validateOptions() error {
+	d, err := lookupDialect(c.Dialect)
+	if err != nil {
+		return err
+	}
+	allowed := d.Options
+	if allowed == nil {
+		return nil
+	}
+	unknown := []string{}
+	for key := range c.Options {
+		found := false
+		for _, a := range allowed {
+			if key == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown %s options: %s (supported: %s)", c.Dialect, strings.Join(unknown, ", "), strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// option returns the named option or def when it is not set
+func (c *Config) option(key, def string) string {
+	if v, ok := c.Options[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// statementTimeout parses the statement_timeout option, a duration such as
+// 30s, zero when it is not set
+func (c *Config) statementTimeout() (time.Duration, error) {
+	v, ok := c.Options["statement_timeout"]
+	if !ok || v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrap(err, "statement_timeout option")
+	}
+	return d, nil
+}
+
+// sortedOptions returns the option keys in a stable order
+func (c *Config) sortedOptions() []string {
+	keys := make([]string, 0, len(c.Options))
+	for k := range c.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// hostPort joins host and port unless host already carries a port. ipv6
+// hosts are bracketed.
+func hostPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
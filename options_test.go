@@ -0,0 +1,100 @@
+package dasorm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOptions(t *testing.T) {
+	config := &Config{Dialect: "postgres", Options: map[string]string{"sslmode": "require"}}
+	assert.NoError(t, config.validateOptions())
+	config.Options["charset"] = "utf8"
+	config.Options["bogus"] = "1"
+	err := config.validateOptions()
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "unknown postgres options: bogus, charset"))
+}
+
+func TestPostgresDSN(t *testing.T) {
+	config := &Config{Host: "db", User: "u", Password: `p'a\ss`, Database: "d"}
+	dsn, err := postgresDSN(config)
+	assert.NoError(t, err)
+	assert.Equal(t, `host='db' port='5432' user='u' password='p\'a\\ss' dbname='d' sslmode='disable'`, dsn)
+	config.Port = "6543"
+	config.Options = map[string]string{"sslmode": "require", "application_name": "app", "statement_timeout": "1m30s"}
+	dsn, err = postgresDSN(config)
+	assert.NoError(t, err)
+	assert.Equal(t, `host='db' port='6543' user='u' password='p\'a\\ss' dbname='d' sslmode='require' application_name='app' statement_timeout='90000'`, dsn)
+	config.Options["statement_timeout"] = "90"
+	_, err = postgresDSN(config)
+	assert.Error(t, err)
+}
+
+func TestMySQLDSN(t *testing.T) {
+	config := &Config{Host: "db", Port: "3307", User: "u", Password: "p@ss", Database: "d",
+		Options: map[string]string{"charset": "utf8mb4", "tls": "true", "timezone": "UTC"}}
+	dsn, err := mysqlDSN(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "u:p@ss@tcp(db:3307)/d?parseTime=true&tls=true&charset=utf8mb4", dsn)
+	for host, addr := range map[string]string{"::1": "[::1]:3307", "fe80::1": "[fe80::1]:3307", "[::1]:3306": "[::1]:3306", "db:3306": "db:3306"} {
+		dsn, err := mysqlDSN(&Config{Host: host, Port: "3307", User: "u", Database: "d"})
+		assert.NoError(t, err)
+		assert.Contains(t, dsn, "@tcp("+addr+")/d", host)
+	}
+	config.Options["statement_timeout"] = "2s"
+	dsn, err = mysqlDSN(config)
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "max_execution_time=2000")
+	config.Options["timezone"] = "Not/AZone"
+	_, err = mysqlDSN(config)
+	assert.Error(t, err)
+}
+
+func TestMSSQLDSN(t *testing.T) {
+	config := &Config{Host: "db", Port: "1433", User: "u", Password: "p@ss", Database: "d",
+		Options: map[string]string{"encrypt": "true", "application_name": "my app"}}
+	assert.Equal(t, "sqlserver://u:p%40ss@db:1433?app+name=my+app&database=d&encrypt=true", mssqlDSN(config))
+	config.Host = "::1"
+	assert.True(t, strings.HasPrefix(mssqlDSN(config), "sqlserver://u:p%40ss@[::1]:1433?"), mssqlDSN(config))
+	config.Host = "fe80::1"
+	assert.True(t, strings.HasPrefix(mssqlDSN(config), "sqlserver://u:p%40ss@[fe80::1]:1433?"), mssqlDSN(config))
+}
+
+func TestSnowflakeDSN(t *testing.T) {
+	config := &Config{Host: "acct", User: "u", Password: "p", Database: "d",
+		Options: map[string]string{"warehouse": "wh", "role": "r", "schema": "s"}}
+	dsn, err := snowflakeDSN(config)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dsn, "u:p@acct.snowflakecomputing.com:443?"), dsn)
+	for _, want := range []string{"database=d", "schema=s", "warehouse=wh", "role=r"} {
+		assert.Contains(t, dsn, want)
+	}
+	config.Options["statement_timeout"] = "1500ms"
+	dsn, err = snowflakeDSN(config)
+	assert.NoError(t, err)
+	assert.Contains(t, dsn, "STATEMENT_TIMEOUT_IN_SECONDS=2")
+	delete(config.Options, "statement_timeout")
+
+	config.Host = "xy12345.us-east-1"
+	dsn, err = snowflakeDSN(config)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dsn, "u:p@xy12345.us-east-1.snowflakecomputing.com:443?"), dsn)
+	assert.Contains(t, dsn, "region=us-east-1")
+
+	config.Host = "xy12345.eu-west-1.snowflakecomputing.com"
+	dsn, err = snowflakeDSN(config)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dsn, "u:p@xy12345.eu-west-1.snowflakecomputing.com:443?"), dsn)
+	assert.Contains(t, dsn, "account=xy12345")
+}
+
+func TestVaultStringMap(t *testing.T) {
+	m, err := vaultStringMap("sslmode=require&application_name=app")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"sslmode": "require", "application_name": "app"}, m)
+	m, err = vaultStringMap(map[string]interface{}{"charset": "utf8"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"charset": "utf8"}, m)
+}
@@ -2,27 +2,66 @@ package dasorm
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" //postgres driver
 	"github.com/pkg/errors"
 )
 
-func connectPostgres(creds *Config) (*Connection, error) {
-	connectionURL := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		creds.Host, 5432, creds.User, creds.Password, creds.Database)
-	db, err := sqlx.Connect("postgres", connectionURL)
+// postgresValue quotes a value for a lib/pq key/value connection string
+func postgresValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
+
+// postgresDSN builds the lib/pq connection string for a config. options lib/pq
+// does not know are sent as run time parameters of the session.
+func postgresDSN(creds *Config) (string, error) {
+	port := creds.Port
+	if port == "" {
+		port = "5432"
+	}
+	params := []string{
+		"host=" + postgresValue(creds.Host),
+		"port=" + postgresValue(port),
+		"user=" + postgresValue(creds.User),
+		"password=" + postgresValue(creds.Password),
+		"dbname=" + postgresValue(creds.Database),
+		"sslmode=" + postgresValue(creds.option("sslmode", "disable")),
+	}
+	for _, key := range creds.sortedOptions() {
+		val := creds.Options[key]
+		switch key {
+		case "sslmode":
+			continue
+		case "statement_timeout":
+			d, err := creds.statementTimeout()
+			if err != nil {
+				return "", err
+			}
+			val = strconv.FormatInt(d.Milliseconds(), 10)
+		}
+		params = append(params, fmt.Sprintf("%s=%s", key, postgresValue(val)))
+	}
+	return strings.Join(params, " "), nil
+}
+
+func connectPostgres(creds *Config) (*sqlx.DB, error) {
+	dsn, err := postgresDSN(creds)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Connect("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxIdleConns(0)
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	return &Connection{
-		DB:      &DB{DB: db},
-		Dialect: &postgres{},
-	}, nil
+	return db, nil
 }
 
 type postgres struct{}
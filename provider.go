@@ -0,0 +1,176 @@
+package dasorm
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ConfigProvider looks up the database config of an environment
+type ConfigProvider interface {
+	Config(ctx context.Context, environment string) (*Config, error)
+}
+
+// ConfigProviderFunc adapts an ordinary function to the ConfigProvider interface
+type ConfigProviderFunc func(ctx context.Context, environment string) (*Config, error)
+
+// Config calls f(ctx, environment)
+func (f ConfigProviderFunc) Config(ctx context.Context, environment string) (*Config, error) {
+	return f(ctx, environment)
+}
+
+// DefaultProvider is used by ConnectDB and ConnectDBTimeout
+var DefaultProvider ConfigProvider = VaultCache
+
+// VaultProvider reads configs from the vault kv store. see SetVaultKV for
+// where they are looked up.
+type VaultProvider struct {
+	// Version reads a specific kv v2 version of the config, 0 reads the latest
+	Version int
+}
+
+// Config reads the config of an environment from vault
+func (p VaultProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	ch := make(chan struct {
+		config *Config
+		err    error
+	}, 1)
+	go func() {
+		config, err := getConfigVaultVersion(environment, p.Version)
+		ch <- struct {
+			config *Config
+			err    error
+		}{config, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case pack := <-ch:
+		return pack.config, pack.err
+	}
+}
+
+// EnvProvider reads configs from environment variables. the variable prefix
+// is the upper cased environment name with dashes replaced by underscores,
+// preceded by Prefix if it is set, e.g. APP_PROD_MYSQL_HOST for the prefix
+// APP and the environment prod-mysql. See ConfigFromEnv.
+type EnvProvider struct {
+	Prefix string
+}
+
+// Config reads the config of an environment from environment variables
+func (p EnvProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	prefix := strings.ToUpper(strings.Replace(environment, "-", "_", -1))
+	if p.Prefix != "" {
+		prefix = strings.TrimSuffix(p.Prefix, "_") + "_" + prefix
+	}
+	return ConfigFromEnv(prefix)
+}
+
+// FileProvider reads configs from a yaml or json file holding a map of
+// environment names to configs keyed like the vault data
+//
+//	dev-local:
+//	  dialect: postgres
+//	  host: localhost
+//	  ...
+type FileProvider struct {
+	Path string
+}
+
+// Config reads the config of an environment from the file
+func (p FileProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read config file")
+	}
+	envs := map[string]map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(p.Path)) {
+	case ".json":
+		err = json.Unmarshal(b, &envs)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &envs)
+	default:
+		return nil, errors.Errorf("unknown config file extension: %s", p.Path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", p.Path)
+	}
+	data, ok := envs[environment]
+	if !ok {
+		return nil, errors.Errorf("no config for %s in %s", environment, p.Path)
+	}
+	return configFromMap(data, p.Path)
+}
+
+// ChainProvider tries each provider in turn and returns the first config found
+type ChainProvider []ConfigProvider
+
+// Config returns the first config found, or an error listing every failure
+func (c ChainProvider) Config(ctx context.Context, environment string) (*Config, error) {
+	if len(c) == 0 {
+		return nil, errors.New("no config providers in chain")
+	}
+	msgs := []string{}
+	for _, p := range c {
+		config, err := p.Config(ctx, environment)
+		if err == nil {
+			return config, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msgs = append(msgs, err.Error())
+	}
+	return nil, errors.Errorf("%s: no provider returned a config: %s", environment, strings.Join(msgs, "; "))
+}
+
+// ConnectDBProvider connects to an environment using the config returned by
+// provider. a cached config is dropped if connecting with it fails so that the
+// next attempt reads it again. the connection reconnects through provider
+// when its health monitor finds the pool unusable.
+func ConnectDBProvider(ctx context.Context, provider ConfigProvider, environment string) (*Connection, error) {
+	config, err := provider.Config(ctx, environment)
+	if err != nil {
+		return nil, errors.Wrap(err, environment)
+	}
+	ch := make(chan struct {
+		conn *Connection
+		err  error
+	}, 1)
+	go func() {
+		conn, err := connectConfig(config)
+		if err != nil {
+			if cache, ok := provider.(*CachedProvider); ok {
+				cache.Invalidate(environment)
+			}
+		} else {
+			conn.DB.source = func(ctx context.Context) (*Config, error) {
+				if cache, ok := provider.(*CachedProvider); ok {
+					cache.Invalidate(environment)
+				}
+				return provider.Config(ctx, environment)
+			}
+		}
+		ch <- struct {
+			conn *Connection
+			err  error
+		}{conn, err}
+	}()
+	select {
+	case <-ctx.Done():
+		go func() {
+			if pack := <-ch; pack.conn != nil {
+				pack.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case pack := <-ch:
+		return pack.conn, pack.err
+	}
+}
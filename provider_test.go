@@ -0,0 +1,93 @@
+package dasorm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAMLConfig = `
+dev-local:
+  dialect: postgres
+  database: db
+  host: localhost
+  port: 5432
+  user: user
+  password: pass
+  max_open_conns: 4
+  options:
+    sslmode: require
+`
+
+const testJSONConfig = `{"dev-local": {"dialect": "mysql", "database": "db", "host": "localhost", "port": "3306", "user": "user", "password": "pass"}}`
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dasorm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "db.yaml")
+	ioutil.WriteFile(yamlPath, []byte(testYAMLConfig), 0600)
+	config, err := FileProvider{Path: yamlPath}.Config(context.Background(), "dev-local")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Dialect:      "postgres",
+		Database:     "db",
+		Host:         "localhost",
+		Port:         "5432",
+		User:         "user",
+		Password:     "pass",
+		MaxOpenConns: 4,
+		Options:      map[string]string{"sslmode": "require"},
+	}, config)
+
+	jsonPath := filepath.Join(dir, "db.json")
+	ioutil.WriteFile(jsonPath, []byte(testJSONConfig), 0600)
+	config, err = FileProvider{Path: jsonPath}.Config(context.Background(), "dev-local")
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql", config.Dialect)
+
+	_, err = FileProvider{Path: jsonPath}.Config(context.Background(), "prod")
+	assert.Error(t, err)
+}
+
+func TestEnvProvider(t *testing.T) {
+	os.Setenv("APP_PROD_MYSQL_DIALECT", "mysql")
+	os.Setenv("APP_PROD_MYSQL_HOST", "db")
+	defer os.Unsetenv("APP_PROD_MYSQL_DIALECT")
+	defer os.Unsetenv("APP_PROD_MYSQL_HOST")
+	config, err := EnvProvider{Prefix: "APP"}.Config(context.Background(), "prod-mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, "db", config.Host)
+}
+
+func TestChainProvider(t *testing.T) {
+	want := &Config{Dialect: "mysql"}
+	failing := ConfigProviderFunc(func(ctx context.Context, env string) (*Config, error) {
+		return nil, errors.New("not here")
+	})
+	found := ConfigProviderFunc(func(ctx context.Context, env string) (*Config, error) {
+		return want, nil
+	})
+	config, err := ChainProvider{failing, found}.Config(context.Background(), "dev")
+	assert.NoError(t, err)
+	assert.Equal(t, want, config)
+
+	_, err = ChainProvider{failing, failing}.Config(context.Background(), "dev")
+	assert.EqualError(t, err, "dev: no provider returned a config: not here; not here")
+}
+
+func TestConnectDBProvider(t *testing.T) {
+	provider := ConfigProviderFunc(func(ctx context.Context, env string) (*Config, error) {
+		return &Config{Dialect: "oracle"}, nil
+	})
+	_, err := ConnectDBProvider(context.Background(), provider, "dev")
+	assert.EqualError(t, err, "oracle dialect not recognized")
+}
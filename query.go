@@ -3,6 +3,7 @@ package dasorm
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Query is the main value that is used to build up a query
@@ -12,6 +13,7 @@ type Query struct {
 	limitResults int
 	whereClauses clauses
 	orderClauses clauses
+	timeout      time.Duration
 	Connection   *Connection
 }
 
@@ -24,10 +26,10 @@ func (c *Connection) First(model interface{}) error {
 func (q *Query) First(model interface{}) error {
 	q.Limit(1)
 	m := &Model{Value: model}
-	if err := q.Connection.Dialect.SelectOne(q.Connection.DB, m, *q); err != nil {
+	if err := q.Connection.Dialect.SelectOne(q.Connection.reader(), m, *q); err != nil {
 		return err
 	}
-	return nil
+	return m.decrypt()
 }
 
 // RawQuery will override the query building feature and will use
@@ -144,17 +146,22 @@ func (c *Connection) All(models interface{}) error {
 //	q.Where("name = ?", "mark").All(&[]User{})
 func (q *Query) All(models interface{}) error {
 	m := &Model{Value: models}
-	if err := q.Connection.Dialect.SelectMany(q.Connection.DB, m, *q); err != nil {
+	if err := q.Connection.Dialect.SelectMany(q.Connection.reader(), m, *q); err != nil {
 		return err
 	}
-	return nil
+	return m.decrypt()
 }
 
 // Create inserts a new model or slice of models
 func (c *Connection) Create(model interface{}) error {
 	sm := &Model{Value: model}
+	restore, err := sm.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
 	return sm.iterate(func(m *Model) error {
-		if err := c.Dialect.Create(c.DB, m); err != nil {
+		if err := c.Dialect.Create(c.writer(), m); err != nil {
 			return err
 		}
 		return nil
@@ -164,7 +171,12 @@ func (c *Connection) Create(model interface{}) error {
 // CreateMany inserts a new model or slice of models
 func (c *Connection) CreateMany(model interface{}) error {
 	sm := &Model{Value: model}
-	if err := c.Dialect.CreateMany(c.DB, sm); err != nil {
+	restore, err := sm.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if err := c.Dialect.CreateMany(c.writer(), sm); err != nil {
 		return err
 	}
 	return nil
@@ -174,7 +186,7 @@ func (c *Connection) CreateMany(model interface{}) error {
 func (c *Connection) Destroy(model interface{}) error {
 	sm := &Model{Value: model}
 	return sm.iterate(func(m *Model) error {
-		if err := c.Dialect.Destroy(c.DB, m); err != nil {
+		if err := c.Dialect.Destroy(c.writer(), m); err != nil {
 			return err
 		}
 		return nil
@@ -184,7 +196,7 @@ func (c *Connection) Destroy(model interface{}) error {
 // DestroyMany deletes many entries from a database
 func (c *Connection) DestroyMany(models interface{}) error {
 	m := &Model{Value: models}
-	if err := c.Dialect.DestroyMany(c.DB, m); err != nil {
+	if err := c.Dialect.DestroyMany(c.writer(), m); err != nil {
 		return err
 	}
 	return nil
@@ -193,10 +205,15 @@ func (c *Connection) DestroyMany(models interface{}) error {
 // Update updates a record
 func (c *Connection) Update(model interface{}) error {
 	sm := &Model{Value: model}
+	restore, err := sm.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
 	return sm.iterate(func(m *Model) error {
 		var err error
 		m.touchUpdatedAt()
-		if err = c.Dialect.Update(c.DB, m); err != nil {
+		if err = c.Dialect.Update(c.writer(), m); err != nil {
 			return err
 		}
 		return nil
@@ -206,7 +223,7 @@ func (c *Connection) Update(model interface{}) error {
 // SQLView performs the sql view query on a model
 func (c *Connection) SQLView(model interface{}, format map[string]string) error {
 	m := &Model{Value: model}
-	if err := c.Dialect.SQLView(c.DB, m, format); err != nil {
+	if err := c.Dialect.SQLView(c.reader(), m, format); err != nil {
 		return err
 	}
 	return nil
@@ -215,7 +232,12 @@ func (c *Connection) SQLView(model interface{}, format map[string]string) error
 // CreateManyUpdate creates or updates
 func (c *Connection) CreateManyUpdate(model interface{}) error {
 	m := &Model{Value: model}
-	if err := c.Dialect.CreateManyUpdate(c.DB, m); err != nil {
+	restore, err := m.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if err := c.Dialect.CreateManyUpdate(c.writer(), m); err != nil {
 		return err
 	}
 	return nil
@@ -224,7 +246,12 @@ func (c *Connection) CreateManyUpdate(model interface{}) error {
 // CreateUpdate creates or updates
 func (c *Connection) CreateUpdate(model interface{}) error {
 	m := &Model{Value: model}
-	if err := c.Dialect.CreateUpdate(c.DB, m); err != nil {
+	restore, err := m.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if err := c.Dialect.CreateUpdate(c.writer(), m); err != nil {
 		return err
 	}
 	return nil
@@ -233,7 +260,12 @@ func (c *Connection) CreateUpdate(model interface{}) error {
 // CreateManyTemp creates models in a temporary table
 func (c *Connection) CreateManyTemp(model interface{}) error {
 	m := &Model{Value: model}
-	if err := c.Dialect.CreateManyTemp(c.DB, m); err != nil {
+	restore, err := m.encrypt()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if err := c.Dialect.CreateManyTemp(c.writer(), m); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,352 @@
+package dasorm
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/estenssoros/dasorm/nulls"
+)
+
+// defaultMask replaces sensitive values when the policy does not set one
+const defaultMask = "[REDACTED]"
+
+// RedactionPolicy decides which values are masked in logged statements,
+// hook arguments and error messages. Fields tagged `dasorm:"sensitive"` are
+// always masked; Columns adds column names that are masked on every model.
+type RedactionPolicy struct {
+	Columns []string
+	Mask    string
+}
+
+var redactionPolicy = &RedactionPolicy{}
+
+// SetRedactionPolicy sets the global redaction policy
+func SetRedactionPolicy(p *RedactionPolicy) {
+	if p == nil {
+		p = &RedactionPolicy{}
+	}
+	redactionPolicy = p
+}
+
+func (p *RedactionPolicy) mask() string {
+	if p.Mask != "" {
+		return p.Mask
+	}
+	return defaultMask
+}
+
+func (p *RedactionPolicy) column(name string) bool {
+	for _, c := range p.Columns {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTagOption reports whether the comma separated `dasorm` tag contains opt
+func hasTagOption(f reflect.StructField, opt string) bool {
+	for _, o := range strings.Split(f.Tag.Get("dasorm"), ",") {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// tagOption returns the value of a name=value option of the `dasorm` tag
+func tagOption(f reflect.StructField, name string) (string, bool) {
+	for _, o := range strings.Split(f.Tag.Get("dasorm"), ",") {
+		if o = strings.TrimSpace(o); strings.HasPrefix(o, name+"=") {
+			return strings.TrimPrefix(o, name+"="), true
+		}
+	}
+	return "", false
+}
+
+// sensitiveColumns returns the db columns of the model that must be masked
+func (m *Model) sensitiveColumns() map[string]bool {
+	t := reflect.TypeOf(m.Value)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	cols := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("db")
+		if name == "" {
+			continue
+		}
+		if hasTagOption(f, "sensitive") || redactionPolicy.column(name) {
+			cols[name] = true
+		}
+	}
+	return cols
+}
+
+// redactor masks sensitive values in a statement, its args and its errors
+type redactor struct {
+	mask    string
+	tuples  map[string]string
+	values  []interface{}
+	strings []string
+}
+
+func newRedactor() *redactor {
+	return &redactor{
+		mask:   redactionPolicy.mask(),
+		tuples: map[string]string{},
+	}
+}
+
+func (r *redactor) empty() bool {
+	return len(r.tuples) == 0 && len(r.values) == 0 && len(r.strings) == 0
+}
+
+// addValue records a sensitive value. zero values are ignored so that empty
+// models do not mask every empty argument.
+func (r *redactor) addValue(v interface{}) {
+	if v == nil || reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface()) {
+		return
+	}
+	r.values = append(r.values, v)
+	switch s := v.(type) {
+	case string:
+		r.strings = append(r.strings, s)
+	case nulls.String:
+		if s.Valid {
+			r.strings = append(r.strings, s.String)
+		}
+	}
+}
+
+// addModel records the tuple and sensitive values of a single struct
+func (r *redactor) addModel(v interface{}, cols map[string]bool) {
+	r.tuples[StringTuple(v)] = stringTuple(v, cols)
+	val := reflect.Indirect(reflect.ValueOf(v))
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if cols[t.Field(i).Tag.Get("db")] {
+			r.addValue(val.Field(i).Interface())
+		}
+	}
+}
+
+// columnPatterns caches the patterns matching sensitive column names in
+// clauses by column
+var columnPatterns sync.Map
+
+// columnPattern returns the pattern matching a column name as a whole word
+func columnPattern(col string) *regexp.Regexp {
+	if re, ok := columnPatterns.Load(col); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(col) + `\b`)
+	columnPatterns.Store(col, re)
+	return re
+}
+
+// addClauses records the args of every clause referencing a sensitive column
+func (r *redactor) addClauses(cs clauses, cols map[string]bool) {
+	for _, c := range cs {
+		for col := range cols {
+			if columnPattern(col).MatchString(c.Fragment) {
+				for _, arg := range c.Arguments {
+					r.addValue(arg)
+				}
+				break
+			}
+		}
+	}
+}
+
+// redactor builds a redactor for the sensitive columns of a model
+func (m *Model) redactor() *redactor {
+	cols := m.sensitiveColumns()
+	if len(cols) == 0 {
+		return nil
+	}
+	r := newRedactor()
+	if m.isSlice() {
+		v := reflect.Indirect(reflect.ValueOf(m.Value))
+		for i := 0; i < v.Len(); i++ {
+			el := v.Index(i)
+			if el.Kind() != reflect.Ptr {
+				el = el.Addr()
+			}
+			r.addModel(el.Interface(), cols)
+		}
+	} else {
+		r.addModel(m.Value, cols)
+	}
+	return r
+}
+
+// Statement masks the sensitive values of stmt
+func (r *redactor) Statement(stmt string) string {
+	for real, masked := range r.tuples {
+		stmt = strings.Replace(stmt, real, masked, -1)
+	}
+	for _, s := range r.strings {
+		stmt = strings.Replace(stmt, "'"+EscapeString(s)+"'", "'"+r.mask+"'", -1)
+	}
+	return stmt
+}
+
+// Args masks the sensitive args
+func (r *redactor) Args(args []interface{}) []interface{} {
+	if len(args) == 0 || len(r.values) == 0 {
+		return args
+	}
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		out[i] = arg
+		for _, v := range r.values {
+			if reflect.DeepEqual(arg, v) {
+				out[i] = r.mask
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Error masks sensitive values in an error message. like Statement it only
+// masks quoted values, escaped as in sql or as the database quotes them in
+// its messages, so that short values do not mask unrelated text.
+func (r *redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := r.Statement(err.Error())
+	for _, s := range r.strings {
+		msg = strings.Replace(msg, "'"+s+"'", "'"+r.mask+"'", -1)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError hides the message of an error while keeping it as the cause
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+// Cause returns the original error
+func (e *redactedError) Cause() error { return e.err }
+
+// Unwrap returns the original error
+func (e *redactedError) Unwrap() error { return e.err }
+
+type redactorKey struct{}
+
+func withRedactor(ctx context.Context, r *redactor) context.Context {
+	if r == nil || r.empty() {
+		return ctx
+	}
+	return context.WithValue(ctx, redactorKey{}, r)
+}
+
+func redactorFromContext(ctx context.Context) *redactor {
+	r, _ := ctx.Value(redactorKey{}).(*redactor)
+	return r
+}
+
+var insertColumnsRegex = regexp.MustCompile(`(?is)INSERT\s+(?:IGNORE\s+)?INTO\s+\S+\s*\(([^)]*)\)\s*VALUES`)
+
+// tupleRedactor builds a redactor for raw tuples written with insertStmt,
+// masking the columns named by the global policy
+func tupleRedactor(insertStmt string, tuples []string) *redactor {
+	match := insertColumnsRegex.FindStringSubmatch(insertStmt)
+	if match == nil || len(redactionPolicy.Columns) == 0 {
+		return nil
+	}
+	cols := strings.Split(match[1], ",")
+	r := newRedactor()
+	for _, t := range tuples {
+		vals := splitTuple(t)
+		if len(vals) != len(cols) {
+			continue
+		}
+		masked := false
+		for i, col := range cols {
+			if redactionPolicy.column(strings.Trim(strings.TrimSpace(col), "`\"[]")) && vals[i] != "NULL" {
+				r.strings = append(r.strings, unescapeString(vals[i]))
+				vals[i] = "'" + r.mask + "'"
+				masked = true
+			}
+		}
+		if masked {
+			r.tuples[t] = "(" + strings.Join(vals, ",") + ")"
+		}
+	}
+	return r
+}
+
+// unescapeString returns the value of a sql literal quoted with EscapeString
+// or with doubled quotes. other literals are returned as they are.
+func unescapeString(lit string) string {
+	if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return lit
+	}
+	lit = lit[1 : len(lit)-1]
+	out := make([]byte, 0, len(lit))
+	for i := 0; i < len(lit); i++ {
+		c := lit[i]
+		switch {
+		case c == '\\' && i+1 < len(lit):
+			i++
+			switch lit[i] {
+			case '0':
+				c = 0
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 'Z':
+				c = '\032'
+			default:
+				c = lit[i]
+			}
+		case c == '\'' && i+1 < len(lit) && lit[i+1] == '\'':
+			i++
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// splitTuple splits a "(a,'b',c)" tuple into its values, respecting quotes
+func splitTuple(t string) []string {
+	t = strings.TrimSpace(t)
+	if !strings.HasPrefix(t, "(") || !strings.HasSuffix(t, ")") {
+		return nil
+	}
+	t = t[1 : len(t)-1]
+	vals := []string{}
+	start, quoted := 0, false
+	for i := 0; i < len(t); i++ {
+		switch t[i] {
+		case '\\':
+			i++
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				vals = append(vals, t[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(vals, t[start:])
+}
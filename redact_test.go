@@ -0,0 +1,81 @@
+package dasorm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type sensitiveStruct struct {
+	ID    uuid.UUID `db:"id"`
+	Name  string    `db:"name"`
+	Email string    `db:"email" dasorm:"sensitive"`
+}
+
+func (s sensitiveStruct) TableName() string {
+	return "people"
+}
+
+func TestRedactorStatement(t *testing.T) {
+	m := &Model{&sensitiveStruct{ID: testUUID, Name: "bob", Email: "bob@example.com"}}
+	stmt := craftCreate(m.TableName(), m)
+	r := m.redactor()
+	have := r.Statement(stmt)
+	assert.Equal(t, "INSERT INTO people (id,name,email) VALUES('"+testUUID.String()+"','bob','[REDACTED]')", have)
+	assert.Equal(t, []interface{}{"bob", "[REDACTED]"}, r.Args([]interface{}{"bob", "bob@example.com"}))
+
+	err := r.Error(errors.New("Duplicate entry 'bob@example.com' for key 'email'"))
+	assert.Equal(t, "Duplicate entry '[REDACTED]' for key 'email'", err.Error())
+	assert.Equal(t, "Duplicate entry 'bob@example.com' for key 'email'", errors.Cause(err).Error())
+}
+
+func TestRedactorNoSensitive(t *testing.T) {
+	m := &Model{NewTestStruct()}
+	assert.Nil(t, m.redactor())
+}
+
+func TestRedactionPolicy(t *testing.T) {
+	SetRedactionPolicy(&RedactionPolicy{Columns: []string{"name"}, Mask: "***"})
+	defer SetRedactionPolicy(nil)
+
+	m := &Model{&sensitiveStruct{ID: testUUID, Name: "bob", Email: "bob@example.com"}}
+	have := m.redactor().Statement(craftCreate(m.TableName(), m))
+	assert.Equal(t, "INSERT INTO people (id,name,email) VALUES('"+testUUID.String()+"','***','***')", have)
+
+	tuples := []string{"(1,'bob','x')", "(2,NULL,'y,z')", "(3,'o\\'brien','x')"}
+	r := tupleRedactor("INSERT INTO people (id,name,note) VALUES", tuples)
+	assert.Equal(t, "INSERT INTO people (id,name,note) VALUES(1,'***','x'),(2,NULL,'y,z'),(3,'***','x')", r.Statement("INSERT INTO people (id,name,note) VALUES"+strings.Join(tuples, ",")))
+	assert.Equal(t, []string{"bob", "o'brien"}, r.strings)
+	assert.Equal(t, "WHERE name = '***'", r.Statement("WHERE name = 'o\\'brien'"))
+	err := r.Error(errors.New("Duplicate entry 'o'brien' for key 'name', bobby"))
+	assert.Equal(t, "Duplicate entry '***' for key 'name', bobby", err.Error(), "only quoted values are masked")
+}
+
+func TestUnescapeString(t *testing.T) {
+	for _, s := range []string{"plain", "o'brien", "a\\b", "line\nbreak\r", "nul\x00", "sub\x1a", `"quoted"`} {
+		assert.Equal(t, s, unescapeString("'"+EscapeString(s)+"'"), s)
+	}
+	assert.Equal(t, "it's", unescapeString("'it''s'"))
+	assert.Equal(t, "42", unescapeString("42"))
+}
+
+func TestRedactedQueryLog(t *testing.T) {
+	conn, fake := newFakeConnection(t, "mysql")
+	entries := []*LogEntry{}
+	conn.SetLogger(LoggerFunc(func(e *LogEntry) { entries = append(entries, e) }))
+
+	model := &sensitiveStruct{Name: "bob", Email: "bob@example.com"}
+	assert.NoError(t, conn.Create(model))
+	assert.Contains(t, fake.Statements()[0], "'bob@example.com'")
+	assert.NotContains(t, entries[0].Statement, "bob@example.com")
+
+	conn.Where("email = ?", "bob@example.com").All(&[]sensitiveStruct{})
+	assert.Equal(t, []interface{}{"[REDACTED]"}, entries[1].Args)
+}
+
+func TestSplitTuple(t *testing.T) {
+	assert.Equal(t, []string{"1", "'a,b'", "'it\\'s'", "NULL"}, splitTuple(`(1,'a,b','it\'s',NULL)`))
+}
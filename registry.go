@@ -0,0 +1,166 @@
+package dasorm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Registry lazily connects to and caches one connection per environment
+//
+//	dbs := dasorm.NewRegistry()
+//	defer dbs.Close()
+//	conn, err := dbs.Get("prod-mysql")
+type Registry struct {
+	// Connect opens the connection of an environment that has no registered
+	// config. defaults to ConnectDB.
+	Connect func(environment string) (*Connection, error)
+
+	mu      sync.Mutex
+	configs map[string]*Config
+	entries map[string]*registryEntry
+	closed  bool
+}
+
+// registryEntry is a connection that is being opened or is open
+type registryEntry struct {
+	ready chan struct{}
+	conn  *Connection
+	err   error
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register sets the config used to connect to an environment instead of
+// looking it up with Connect
+func (r *Registry) Register(environment string, config *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.configs == nil {
+		r.configs = map[string]*Config{}
+	}
+	r.configs[environment] = config
+}
+
+// Get returns the connection of an environment, connecting on first use.
+// concurrent calls for the same environment share one connection attempt; a
+// failed attempt is retried on the next call.
+func (r *Registry) Get(environment string) (*Connection, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, errors.New("registry is closed")
+	}
+	if e, ok := r.entries[environment]; ok {
+		r.mu.Unlock()
+		<-e.ready
+		return e.conn, e.err
+	}
+	if r.entries == nil {
+		r.entries = map[string]*registryEntry{}
+	}
+	e := &registryEntry{ready: make(chan struct{})}
+	r.entries[environment] = e
+	config := r.configs[environment]
+	r.mu.Unlock()
+
+	e.conn, e.err = r.open(environment, config)
+
+	r.mu.Lock()
+	if e.err != nil {
+		delete(r.entries, environment)
+	} else if r.closed {
+		e.conn.Close()
+		e.conn, e.err = nil, errors.New("registry is closed")
+	}
+	r.mu.Unlock()
+	close(e.ready)
+	return e.conn, e.err
+}
+
+func (r *Registry) open(environment string, config *Config) (*Connection, error) {
+	if config != nil {
+		return ConnectDBConfig(config)
+	}
+	if r.Connect != nil {
+		return r.Connect(environment)
+	}
+	return ConnectDB(environment)
+}
+
+// ready returns the open connections by environment
+func (r *Registry) ready() map[string]*Connection {
+	r.mu.Lock()
+	entries := make(map[string]*registryEntry, len(r.entries))
+	for name, e := range r.entries {
+		entries[name] = e
+	}
+	r.mu.Unlock()
+	conns := map[string]*Connection{}
+	for name, e := range entries {
+		<-e.ready
+		if e.err == nil {
+			conns[name] = e.conn
+		}
+	}
+	return conns
+}
+
+// Health checks every open connection. see Connection.Health.
+func (r *Registry) Health() map[string]HealthStatus {
+	out := map[string]HealthStatus{}
+	for name, conn := range r.ready() {
+		out[name] = conn.Health()
+	}
+	return out
+}
+
+// Healthy reports whether every open connection is healthy, listing the
+// unhealthy environments in the error
+func (r *Registry) Healthy() error {
+	failed := []string{}
+	for name, status := range r.Health() {
+		if status.Healthy {
+			continue
+		}
+		reason := "health unknown"
+		if status.LastError != nil {
+			reason = status.LastError.Error()
+		}
+		failed = append(failed, name+": "+reason)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return errors.Errorf("unhealthy connections: %s", strings.Join(failed, "; "))
+}
+
+// Remove closes and forgets the connection of an environment
+func (r *Registry) Remove(environment string) {
+	r.mu.Lock()
+	e, ok := r.entries[environment]
+	delete(r.entries, environment)
+	r.mu.Unlock()
+	if ok {
+		<-e.ready
+		if e.conn != nil {
+			e.conn.Close()
+		}
+	}
+}
+
+// Close closes every connection. Get fails once the registry is closed.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	for _, conn := range r.ready() {
+		conn.Close()
+	}
+}
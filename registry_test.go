@@ -0,0 +1,78 @@
+package dasorm
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	var calls int32
+	fail := true
+	r := NewRegistry()
+	r.Connect = func(env string) (*Connection, error) {
+		atomic.AddInt32(&calls, 1)
+		if env == "broken" && fail {
+			return nil, errors.New("no route to host")
+		}
+		time.Sleep(10 * time.Millisecond)
+		conn, _ := newFakeConnection(t, "mysql")
+		return conn, nil
+	}
+
+	var wg sync.WaitGroup
+	conns := make([]*Connection, 10)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conns[i], _ = r.Get("prod-mysql")
+		}(i)
+	}
+	wg.Wait()
+	for _, conn := range conns {
+		assert.True(t, conn == conns[0])
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, err := r.Get("broken")
+	assert.EqualError(t, err, "no route to host")
+	fail = false
+	_, err = r.Get("broken")
+	assert.NoError(t, err, "failed connections are retried")
+
+	r.Register("custom", &Config{Dialect: "oracle"})
+	_, err = r.Get("custom")
+	assert.EqualError(t, err, "oracle dialect not recognized")
+
+	assert.NoError(t, r.Healthy())
+	assert.Len(t, r.Health(), 2)
+	conns[0].DB.pool().Close()
+	assert.EqualError(t, r.Healthy(), "unhealthy connections: prod-mysql: sql: database is closed")
+
+	r.Remove("prod-mysql")
+	assert.Len(t, r.Health(), 1)
+
+	broken, _ := r.Get("broken")
+	r.Close()
+	assert.Error(t, broken.Ping())
+	_, err = r.Get("broken")
+	assert.EqualError(t, err, "registry is closed")
+}
+
+func TestRegistryHealthUnknown(t *testing.T) {
+	r := NewRegistry()
+	r.Connect = func(env string) (*Connection, error) {
+		conn, _ := newFakeConnection(t, "mysql")
+		// a monitor that has not checked yet
+		conn.DB.health = &healthMonitor{}
+		return conn, nil
+	}
+	_, err := r.Get("prod-mysql")
+	assert.NoError(t, err)
+	assert.EqualError(t, r.Healthy(), "unhealthy connections: prod-mysql: health unknown")
+}
@@ -0,0 +1,281 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// DefaultReplicaCheckInterval is how often replicas are pinged
+const DefaultReplicaCheckInterval = 10 * time.Second
+
+// replica is a read replica and whether its last health check passed
+type replica struct {
+	conn    *Connection
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// check pings the replica and records the result
+func (r *replica) check(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := r.conn.DB.pool().PingContext(ctx)
+	if err == nil {
+		atomic.StoreInt32(&r.healthy, 1)
+		return
+	}
+	if atomic.SwapInt32(&r.healthy, 0) == 1 {
+		log.Printf("[dasorm] replica unhealthy: %v", err)
+	}
+}
+
+// replicaSet spreads reads over the healthy replicas round-robin
+type replicaSet struct {
+	mu       sync.RWMutex
+	replicas []*replica
+	next     uint32
+	interval time.Duration
+	stop     chan struct{}
+	closed   bool
+}
+
+// pick returns the next healthy replica, or nil if there is none
+func (s *replicaSet) pick() *Connection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := len(s.replicas)
+	for i := 0; i < n; i++ {
+		r := s.replicas[int(atomic.AddUint32(&s.next, 1)-1)%n]
+		if r.isHealthy() {
+			return r.conn
+		}
+	}
+	return nil
+}
+
+// checkAll pings every replica
+func (s *replicaSet) checkAll() {
+	s.mu.RLock()
+	replicas := append([]*replica{}, s.replicas...)
+	timeout := s.interval
+	s.mu.RUnlock()
+	for _, r := range replicas {
+		r.check(timeout)
+	}
+}
+
+// start runs the health checks until stop is closed. it does nothing once
+// the set is closed.
+func (s *replicaSet) start(interval time.Duration) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.interval = interval
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.checkAll()
+			}
+		}
+	}()
+}
+
+// close stops the health checks and closes the replicas
+func (s *replicaSet) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	for _, r := range s.replicas {
+		r.conn.Close()
+	}
+	s.replicas = nil
+}
+
+// replicaSet returns the replicas of the db, if any
+func (db *DB) replicaSet() *replicaSet {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.replicas
+}
+
+// addReplicaSet returns the replicas of the db, creating the set if needed.
+// it returns nil once the db is closed.
+func (db *DB) addReplicaSet() *replicaSet {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.replicas == nil && !db.closed {
+		db.replicas = &replicaSet{}
+		db.closers = append(db.closers, db.replicas.close)
+	}
+	return db.replicas
+}
+
+// AddReplica adds a read replica to the connection. First, All, SQLView and
+// the raw Query methods are spread over the healthy replicas round-robin;
+// writes and transactions always use the primary. the replica is closed
+// with the connection.
+func (c *Connection) AddReplica(conn *Connection) error {
+	if conn.DialectName() != c.DialectName() {
+		return errors.Errorf("replica dialect %s does not match %s", conn.DialectName(), c.DialectName())
+	}
+	set := c.DB.addReplicaSet()
+	if set == nil {
+		return errors.New("connection is closed")
+	}
+	r := &replica{conn: conn}
+	r.check(DefaultReplicaCheckInterval)
+	set.mu.Lock()
+	if set.closed {
+		set.mu.Unlock()
+		return errors.New("connection is closed")
+	}
+	set.replicas = append(set.replicas, r)
+	started := set.stop != nil
+	set.mu.Unlock()
+	if !started {
+		set.start(DefaultReplicaCheckInterval)
+	}
+	return nil
+}
+
+// SetReplicaCheckInterval changes how often replicas are pinged
+func (c *Connection) SetReplicaCheckInterval(interval time.Duration) {
+	if set := c.DB.replicaSet(); set != nil && interval > 0 {
+		set.start(interval)
+	}
+}
+
+// ConnectDBReplicas connects to a primary environment and its replica
+// environments
+func ConnectDBReplicas(primary string, replicas ...string) (*Connection, error) {
+	conn, err := ConnectDB(primary)
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range replicas {
+		replica, err := ConnectDB(env)
+		if err == nil {
+			err = conn.AddReplica(replica)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, env)
+		}
+	}
+	return conn, nil
+}
+
+// ConnectDBConfigReplicas connects to a primary and its replicas
+func ConnectDBConfigReplicas(primary *Config, replicas ...*Config) (*Connection, error) {
+	conn, err := ConnectDBConfig(primary)
+	if err != nil {
+		return nil, err
+	}
+	for _, config := range replicas {
+		replica, err := ConnectDBConfig(config)
+		if err == nil {
+			err = conn.AddReplica(replica)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, config.Host)
+		}
+	}
+	return conn, nil
+}
+
+// OnPrimary returns a copy of the connection that sends reads to the
+// primary, e.g. to read a record right after writing it
+func (c *Connection) OnPrimary() *Connection {
+	cp := *c
+	cp.onPrimary = true
+	return &cp
+}
+
+// reader returns the db reads are sent to: a healthy replica sharing the
+// primary's loggers and hooks, or the primary. tenant scoped connections
+// read from the pool of the tenant.
+func (c *Connection) reader() *DB {
+	if c.onPrimary || c.tenant != (tenant{}) {
+		return c.writer()
+	}
+	set := c.DB.replicaSet()
+	if set == nil {
+		return c.DB
+	}
+	r := set.pick()
+	if r == nil {
+		return c.DB
+	}
+	return c.DB.withPool(r.DB.pool())
+}
+
+// withPool returns a db using pool with the settings of db
+func (db *DB) withPool(pool *sqlx.DB) *DB {
+	return &DB{
+		DB:      pool,
+		Debug:   db.Debug,
+		Logger:  db.Logger,
+		SlowLog: db.SlowLog,
+		Hooks:   db.Hooks,
+		dialect: db.dialect,
+
+		StatementTimeout: db.StatementTimeout,
+	}
+}
+
+// Begin starts a transaction on the primary, or the pool of the tenant
+func (c *Connection) Begin() (*sqlx.Tx, error) {
+	db := c.writer()
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.pool().Beginx()
+}
+
+// BeginTx starts a transaction on the primary, or the pool of the tenant
+func (c *Connection) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	db := c.writer()
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.pool().BeginTxx(ctx, opts)
+}
+
+// Conn returns a single session of the primary, or of the pool of the
+// tenant, e.g. to hold a session level lock. it must be closed to be
+// returned to the pool.
+func (c *Connection) Conn(ctx context.Context) (*sql.Conn, error) {
+	db := c.writer()
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.pool().Conn(ctx)
+}
@@ -0,0 +1,61 @@
+package dasorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	conn, primary := newFakeConnection(t, "postgres")
+	r1, fake1 := newFakeConnection(t, "postgres")
+	r2, fake2 := newFakeConnection(t, "postgres")
+	assert.NoError(t, conn.AddReplica(r1))
+	assert.NoError(t, conn.AddReplica(r2))
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, conn.All(&[]test{}))
+	}
+	assert.Len(t, fake1.Statements(), 2)
+	assert.Len(t, fake2.Statements(), 2)
+
+	assert.NoError(t, conn.Create(&test{}))
+	rows, err := conn.OnPrimary().Query("SELECT 1")
+	assert.NoError(t, err)
+	rows.Close()
+	assert.Len(t, primary.Statements(), 2)
+	assert.Equal(t, "SELECT 1", primary.Statements()[1])
+
+	tx, err := conn.Begin()
+	assert.NoError(t, err)
+	tx.Rollback()
+
+	// an unhealthy replica is skipped until it recovers
+	r1.DB.pool().Close()
+	conn.DB.replicaSet().checkAll()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, conn.All(&[]test{}))
+	}
+	assert.Len(t, fake2.Statements(), 4)
+
+	r2.DB.pool().Close()
+	conn.DB.replicaSet().checkAll()
+	assert.NoError(t, conn.All(&[]test{}))
+	assert.Len(t, primary.Statements(), 3, "reads fall back to the primary")
+
+	conn.Close()
+	assert.Nil(t, conn.DB.replicaSet().replicas)
+	conn.SetReplicaCheckInterval(time.Second)
+	assert.Nil(t, conn.DB.replicaSet().stop, "no checks start once closed")
+}
+
+func TestAddReplicaDialect(t *testing.T) {
+	conn, _ := newFakeConnection(t, "postgres")
+	replica, _ := newFakeConnection(t, "mysql")
+	assert.EqualError(t, conn.AddReplica(replica), "replica dialect mysql does not match postgres")
+
+	conn.Close()
+	replica, _ = newFakeConnection(t, "postgres")
+	assert.EqualError(t, conn.AddReplica(replica), "connection is closed")
+}
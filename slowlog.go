@@ -0,0 +1,178 @@
+package dasorm
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSlowQueryTopN is the number of fingerprints Top returns when TopN is unset
+const defaultSlowQueryTopN = 10
+
+// SlowQueryLog reports statements that take longer than Threshold and keeps
+// a summary of the slowest statement fingerprints
+type SlowQueryLog struct {
+	// Threshold is the duration a statement must exceed to be reported
+	Threshold time.Duration
+	// Logger receives slow entries. Defaults to the standard log package.
+	Logger Logger
+	// RedactArgs replaces bound args with placeholders and the statement
+	// with its fingerprint before reporting, so neither bound nor inlined
+	// values are logged. the values of sensitive fields are redacted either
+	// way, see RedactionPolicy.
+	RedactArgs bool
+	// TopN is the number of fingerprints kept in the summary
+	TopN int
+
+	mu    sync.Mutex
+	stats map[string]*SlowQueryStat
+}
+
+// SlowQueryStat summarizes the slow executions of a single fingerprint
+type SlowQueryStat struct {
+	Fingerprint string
+	Count       int
+	Total       time.Duration
+	Max         time.Duration
+	LastCaller  string
+	LastSeen    time.Time
+}
+
+// Mean returns the average duration of the slow executions
+func (s SlowQueryStat) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// NewSlowQueryLog creates a slow query log with a threshold
+func NewSlowQueryLog(threshold time.Duration) *SlowQueryLog {
+	return &SlowQueryLog{Threshold: threshold}
+}
+
+// SetSlowQueryLog sets the slow query log for the connection
+func (c *Connection) SetSlowQueryLog(s *SlowQueryLog) {
+	c.DB.SlowLog = s
+}
+
+func (s *SlowQueryLog) topN() int {
+	if s.TopN > 0 {
+		return s.TopN
+	}
+	return defaultSlowQueryTopN
+}
+
+// observe reports entry if it exceeds the threshold
+func (s *SlowQueryLog) observe(entry *LogEntry) {
+	if entry.Duration <= s.Threshold {
+		return
+	}
+	slow := *entry
+	slow.Fingerprint = Fingerprint(entry.Statement)
+	if s.RedactArgs {
+		slow.Statement = slow.Fingerprint
+		if len(slow.Args) > 0 {
+			slow.Args = redactArgs(slow.Args)
+		}
+	}
+	s.record(&slow)
+	if s.Logger != nil {
+		s.Logger.Log(&slow)
+		return
+	}
+	log.Printf("[dasorm] slow query (> %s): %s", s.Threshold, slow.String())
+}
+
+func (s *SlowQueryLog) record(entry *LogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		s.stats = map[string]*SlowQueryStat{}
+	}
+	stat, ok := s.stats[entry.Fingerprint]
+	if !ok {
+		s.evict()
+		stat = &SlowQueryStat{Fingerprint: entry.Fingerprint}
+		s.stats[entry.Fingerprint] = stat
+	}
+	stat.Count++
+	stat.Total += entry.Duration
+	if entry.Duration > stat.Max {
+		stat.Max = entry.Duration
+	}
+	stat.LastCaller = entry.Caller
+	stat.LastSeen = time.Now().UTC()
+}
+
+// evict drops the fastest fingerprint once the summary is full. the summary
+// keeps more than TopN entries so that new fingerprints have room to climb.
+func (s *SlowQueryLog) evict() {
+	if len(s.stats) < s.topN()*10 {
+		return
+	}
+	var fastest *SlowQueryStat
+	for _, stat := range s.stats {
+		if fastest == nil || stat.Max < fastest.Max {
+			fastest = stat
+		}
+	}
+	delete(s.stats, fastest.Fingerprint)
+}
+
+// Top returns the slowest fingerprints ordered by their max duration
+func (s *SlowQueryLog) Top() []SlowQueryStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]SlowQueryStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		out = append(out, *stat)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Max > out[j].Max
+	})
+	if n := s.topN(); len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// Reset clears the summary
+func (s *SlowQueryLog) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats = nil
+}
+
+func redactArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i := range args {
+		out[i] = "?"
+	}
+	return out
+}
+
+var (
+	fingerprintString  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	fingerprintNumber  = regexp.MustCompile(`\b-?\d+(?:\.\d+)?\b`)
+	fingerprintList    = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintTuples  = regexp.MustCompile(`(?i)(VALUES\s*\(\?\+\))(?:\s*,\s*\(\?\+\))+`)
+	fingerprintSpace   = regexp.MustCompile(`\s+`)
+	fingerprintDollars = regexp.MustCompile(`\$\d+|@p\d+`)
+)
+
+// Fingerprint normalizes a statement so that executions which only differ by
+// their literal values, placeholders, IN lists or number of inserted rows
+// share the same fingerprint
+func Fingerprint(stmt string) string {
+	fp := fingerprintString.ReplaceAllString(stmt, "?")
+	fp = fingerprintDollars.ReplaceAllString(fp, "?")
+	fp = fingerprintNumber.ReplaceAllString(fp, "?")
+	fp = fingerprintList.ReplaceAllString(fp, "(?+)")
+	fp = fingerprintTuples.ReplaceAllString(fp, "$1")
+	fp = fingerprintSpace.ReplaceAllString(fp, " ")
+	return strings.TrimSpace(fp)
+}
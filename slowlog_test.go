@@ -0,0 +1,61 @@
+package dasorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want string
+	}{
+		{"SELECT id FROM test WHERE id = 7", "SELECT id FROM test WHERE id = ?"},
+		{"SELECT id FROM test WHERE name = 'it''s'", "SELECT id FROM test WHERE name = ?"},
+		{"SELECT id FROM test WHERE id IN (?, ?, ?)", "SELECT id FROM test WHERE id IN (?+)"},
+		{"SELECT id FROM test WHERE id IN ('a','b')", "SELECT id FROM test WHERE id IN (?+)"},
+		{"SELECT id FROM test WHERE id = $1 AND a = @p2", "SELECT id FROM test WHERE id = ? AND a = ?"},
+		{"INSERT INTO test (id,name) VALUES('a','b'),('c','d')", "INSERT INTO test (id,name) VALUES(?+)"},
+		{"SELECT t1.id\n  FROM   t1", "SELECT t1.id FROM t1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Fingerprint(tt.stmt), tt.stmt)
+	}
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	reported := []*LogEntry{}
+	s := NewSlowQueryLog(10 * time.Millisecond)
+	s.RedactArgs = true
+	s.TopN = 2
+	s.Logger = LoggerFunc(func(e *LogEntry) { reported = append(reported, e) })
+
+	s.observe(&LogEntry{Statement: "SELECT 1", Duration: time.Millisecond})
+	assert.Empty(t, reported)
+
+	s.observe(&LogEntry{Statement: "SELECT a FROM t WHERE id = 1", Args: []interface{}{"secret"}, Duration: 20 * time.Millisecond})
+	s.observe(&LogEntry{Statement: "SELECT a FROM t WHERE id = 2", Duration: 40 * time.Millisecond})
+	s.observe(&LogEntry{Statement: "SELECT b FROM t", Duration: 30 * time.Millisecond})
+	s.observe(&LogEntry{Statement: "SELECT c FROM t", Duration: 15 * time.Millisecond})
+	assert.Len(t, reported, 4)
+	assert.Equal(t, []interface{}{"?"}, reported[0].Args)
+	assert.Equal(t, "SELECT a FROM t WHERE id = ?", reported[0].Fingerprint)
+	assert.Equal(t, "SELECT a FROM t WHERE id = ?", reported[0].Statement, "inlined values are redacted too")
+
+	top := s.Top()
+	assert.Len(t, top, 2)
+	assert.Equal(t, "SELECT a FROM t WHERE id = ?", top[0].Fingerprint)
+	assert.Equal(t, 2, top[0].Count)
+	assert.Equal(t, 40*time.Millisecond, top[0].Max)
+	assert.Equal(t, 30*time.Millisecond, top[0].Mean())
+	assert.Equal(t, "SELECT b FROM t", top[1].Fingerprint)
+
+	s.Reset()
+	assert.Empty(t, s.Top())
+
+	s.RedactArgs = false
+	s.observe(&LogEntry{Statement: "INSERT INTO t VALUES ('a', 1)", Duration: 20 * time.Millisecond})
+	assert.Equal(t, "INSERT INTO t VALUES ('a', 1)", reported[4].Statement)
+}
@@ -1,15 +1,62 @@
 package dasorm
 
 import (
-	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
-	_ "github.com/snowflakedb/gosnowflake" // snowflake
+	"github.com/snowflakedb/gosnowflake" // snowflake
 )
 
-func connectSnowflake(creds *Config) (*Connection, error) {
-	connectionURL := fmt.Sprintf("%s:%s@%s/%s", creds.User, creds.Password, creds.Host, creds.Database)
+// snowflakeDSN builds the gosnowflake dsn for a config. a host without dots
+// is treated as the account name, as it always has been.
+func snowflakeDSN(creds *Config) (string, error) {
+	cfg := &gosnowflake.Config{
+		User:        creds.User,
+		Password:    creds.Password,
+		Database:    creds.Database,
+		Schema:      creds.option("schema", ""),
+		Warehouse:   creds.option("warehouse", ""),
+		Role:        creds.option("role", ""),
+		Application: creds.option("application_name", "Go"),
+	}
+	// a host is a hostname only when it is a snowflake domain or has a port;
+	// otherwise it is the account, account.region included, and gosnowflake
+	// derives the host and region from it
+	if strings.HasSuffix(creds.Host, ".snowflakecomputing.com") || creds.Port != "" {
+		cfg.Host = creds.Host
+		cfg.Account = creds.option("account", strings.Split(creds.Host, ".")[0])
+	} else {
+		cfg.Account = creds.Host
+	}
+	if creds.Port != "" {
+		port, err := strconv.Atoi(creds.Port)
+		if err != nil {
+			return "", errors.Wrap(err, "snowflake port")
+		}
+		cfg.Port = port
+	}
+	cfg.Params = map[string]*string{}
+	if tz, ok := creds.Options["timezone"]; ok {
+		cfg.Params["timezone"] = &tz
+	}
+	d, err := creds.statementTimeout()
+	if err != nil {
+		return "", err
+	}
+	if d > 0 {
+		secs := strconv.FormatInt(ceilSeconds(d), 10)
+		cfg.Params["STATEMENT_TIMEOUT_IN_SECONDS"] = &secs
+	}
+	return gosnowflake.DSN(cfg)
+}
+
+func connectSnowflake(creds *Config) (*sqlx.DB, error) {
+	connectionURL, err := snowflakeDSN(creds)
+	if err != nil {
+		return nil, err
+	}
 	db, err := sqlx.Connect("snowflake", connectionURL)
 	if err != nil {
 		return nil, err
@@ -17,10 +64,7 @@ func connectSnowflake(creds *Config) (*Connection, error) {
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	return &Connection{
-		DB:      &DB{DB: db},
-		Dialect: &snowflake{},
-	}, nil
+	return db, nil
 }
 
 type snowflake struct{}
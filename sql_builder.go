@@ -68,11 +68,11 @@ func (sq *sqlBuilder) buildSelectSQL() string {
 	case "mssql":
 		sql = "SELECT "
 		sql = sq.buildPaginationClauses(sql)
-		sql += fmt.Sprintf("%s FROM %s", strings.Join(cols, ","), sq.Model.TableName())
+		sql += fmt.Sprintf("%s FROM %s", strings.Join(cols, ","), sq.tableName())
 		sql = sq.buildWhereClauses(sql)
 		sql = sq.buildOrderClauses(sql)
 	default:
-		sql = fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), sq.Model.TableName())
+		sql = fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), sq.tableName())
 		sql = sq.buildWhereClauses(sql)
 		sql = sq.buildOrderClauses(sql)
 		sql = sq.buildPaginationClauses(sql)
@@ -80,6 +80,11 @@ func (sq *sqlBuilder) buildSelectSQL() string {
 	return sql
 }
 
+// tableName is the table of the model qualified for the tenant of the query
+func (sq *sqlBuilder) tableName() string {
+	return qualify(sq.Query.Connection.qualifier(), sq.Model.TableName())
+}
+
 func (sq *sqlBuilder) buildWhereClauses(sql string) string {
 	wc := sq.Query.whereClauses
 	if len(wc) > 0 {
@@ -5,15 +5,23 @@ import "fmt"
 // InsertStmt creates insert statement from struct tags
 func InsertStmt(t interface{}) string {
 	m := &Model{Value: t}
+	return insertStmt(m.TableName(), m)
+}
+
+func insertStmt(table string, m *Model) string {
 	stmt := "INSERT INTO %s (%s) VALUES"
-	return fmt.Sprintf(stmt, m.TableName(), m.Columns())
+	return fmt.Sprintf(stmt, table, m.Columns())
 }
 
 // InsertTempStmt inserts into a temporary table
 func InsertTempStmt(t interface{}) string {
 	m := &Model{Value: t}
+	return insertTempStmt(m.TableName(), m)
+}
+
+func insertTempStmt(table string, m *Model) string {
 	stmt := "INSERT INTO %s_TEMP (%s) VALUES"
-	return fmt.Sprintf(stmt, m.TableName(), m.Columns())
+	return fmt.Sprintf(stmt, table, m.Columns())
 }
 
 // ReplaceStmt creates insert replac estatement from struct tags
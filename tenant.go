@@ -0,0 +1,324 @@
+package dasorm
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// tenantName is the identifiers accepted as tenant schemas and databases.
+// they end up in generated sql so nothing that needs quoting is allowed.
+var tenantName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tenant is the schema and database a connection is scoped to
+type tenant struct {
+	schema   string
+	database string
+}
+
+func (t tenant) key() string {
+	return t.database + "." + t.schema
+}
+
+// WithSchema returns a copy of the connection scoped to a schema. table names
+// of generated sql are qualified with the schema and, when the connection
+// knows its config, statements run on a pool of its own whose sessions use
+// the schema (search_path on postgres, the default schema on snowflake), so
+// raw sql is scoped too and no session setting leaks between tenants.
+func (c *Connection) WithSchema(name string) (*Connection, error) {
+	t := c.tenant
+	t.schema = name
+	return c.withTenant(t, name)
+}
+
+// WithDatabase returns a copy of the connection scoped to a database. see
+// WithSchema. on mysql this is the equivalent of USE.
+func (c *Connection) WithDatabase(name string) (*Connection, error) {
+	t := c.tenant
+	t.database = name
+	return c.withTenant(t, name)
+}
+
+func (c *Connection) withTenant(t tenant, name string) (*Connection, error) {
+	if !tenantName.MatchString(name) {
+		return nil, errors.Errorf("invalid tenant name %q", name)
+	}
+	pool, err := c.DB.tenantPool(t)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+	if pool == nil && t.database != "" && c.DialectName() == "postgres" {
+		return nil, errors.New("postgres connection cannot switch databases without a config")
+	}
+	cp := *c
+	cp.tenant = t
+	return &cp, nil
+}
+
+// qualifier returns the prefix of the table names of a scoped connection
+func (c *Connection) qualifier() string {
+	t := c.tenant
+	switch c.DialectName() {
+	case "mysql":
+		if t.database != "" {
+			return t.database
+		}
+		return t.schema
+	case "postgres":
+		return t.schema
+	default:
+		if t.database != "" {
+			return t.database + "." + t.schema
+		}
+		return t.schema
+	}
+}
+
+// qualify prefixes a table name with a tenant schema or database unless it
+// is qualified already
+func qualify(qualifier, name string) string {
+	if qualifier != "" && !strings.Contains(name, ".") {
+		return qualifier + "." + name
+	}
+	return name
+}
+
+// tableName returns the table of a model qualified for the tenant of the db
+func (db *DB) tableName(m *Model) string {
+	return qualify(db.qualifier, m.TableName())
+}
+
+// tableDef reads the table of a model qualified for the tenant of the
+// connection
+func (c *Connection) tableDef(v interface{}) (*tableDef, error) {
+	def, err := (&Model{Value: v}).tableDef(c.DialectName())
+	if err != nil {
+		return nil, err
+	}
+	def.name = qualify(c.qualifier(), def.name)
+	return def, nil
+}
+
+// writer returns the db statements are sent to: the primary, or for a
+// tenant the pool of the tenant, or the primary's if the tenant shares it,
+// qualifying table names. if the pool of the tenant cannot be opened the db
+// fails every statement instead of running it unscoped on the primary.
+func (c *Connection) writer() *DB {
+	if c.tenant == (tenant{}) {
+		return c.DB
+	}
+	pool, err := c.DB.tenantPool(c.tenant)
+	if err != nil {
+		return c.DB.failed(errors.Wrapf(err, "tenant %s", c.qualifier()))
+	}
+	if pool == nil {
+		pool = c.DB.pool()
+	}
+	db := c.DB.withPool(pool)
+	db.qualifier = c.qualifier()
+	return db
+}
+
+// tenantConfig returns config with its sessions scoped to t, or nil if the
+// dialect cannot scope sessions to it. sql server cannot change the default
+// schema of a session, so its schema tenants only qualify table names.
+func tenantConfig(config *Config, t tenant) *Config {
+	out := config.clone()
+	if out.Options == nil {
+		out.Options = map[string]string{}
+	}
+	name := out.Dialect
+	if d, err := lookupDialect(name); err == nil {
+		name = d.Dialect.Name()
+	}
+	switch name {
+	case "mysql":
+		out.Database = t.database
+		if out.Database == "" {
+			out.Database = t.schema
+		}
+	case "postgres":
+		if t.database != "" {
+			out.Database = t.database
+		}
+		if t.schema != "" {
+			out.Options["search_path"] = t.schema
+		}
+	case "snowflake":
+		if t.database != "" {
+			out.Database = t.database
+		}
+		if t.schema != "" {
+			out.Options["schema"] = t.schema
+		}
+	default:
+		if t.database == "" {
+			return nil
+		}
+		out.Database = t.database
+	}
+	return out
+}
+
+// MaxTenantPools is how many tenant pools a connection keeps open. when
+// another tenant needs one the least recently used pool is closed once the
+// statements, transactions and rows using it are done, see closeDrained, and
+// opened again on its next use.
+const MaxTenantPools = 16
+
+// tenantPool returns the pool of a tenant, opening it on first use. it
+// returns nil if the db has no config source to open one with or the
+// dialect cannot scope sessions to the tenant, in which case the shared pool
+// is used with qualified table names.
+func (db *DB) tenantPool(t tenant) (*sqlx.DB, error) {
+	key := t.key()
+	db.mu.Lock()
+	pool, ok := db.tenants[key]
+	if ok {
+		db.useTenant(key, pool)
+	}
+	closed, source := db.closed, db.source
+	db.mu.Unlock()
+	if ok {
+		return pool, nil
+	}
+	if closed {
+		return nil, errors.New("connection is closed")
+	}
+	if source == nil {
+		return nil, nil
+	}
+	config, err := source(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if config = tenantConfig(config, t); config != nil {
+		conn, err := connectConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		pool = conn.DB.pool()
+	}
+
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		if pool != nil {
+			pool.Close()
+		}
+		return nil, errors.New("connection is closed")
+	}
+	if existing, ok := db.tenants[key]; ok {
+		db.useTenant(key, existing)
+		db.mu.Unlock()
+		if pool != nil {
+			pool.Close()
+		}
+		return existing, nil
+	}
+	if db.tenants == nil {
+		db.tenants = map[string]*sqlx.DB{}
+	}
+	db.tenants[key] = pool
+	db.useTenant(key, pool)
+	var evicted *sqlx.DB
+	if len(db.tenantOrder) > MaxTenantPools {
+		oldest := db.tenantOrder[0]
+		db.tenantOrder = db.tenantOrder[1:]
+		evicted = db.tenants[oldest]
+		delete(db.tenants, oldest)
+	}
+	db.mu.Unlock()
+	if evicted != nil {
+		closeDrained(evicted, nil)
+	}
+	return pool, nil
+}
+
+// useTenant marks the pool of a tenant as the most recently used. db.mu must
+// be held.
+func (db *DB) useTenant(key string, pool *sqlx.DB) {
+	if pool == nil {
+		return
+	}
+	for i, k := range db.tenantOrder {
+		if k == key {
+			db.tenantOrder = append(db.tenantOrder[:i], db.tenantOrder[i+1:]...)
+			break
+		}
+	}
+	db.tenantOrder = append(db.tenantOrder, key)
+}
+
+// sharedSchemas are the system and default schemas that are never tenants
+var sharedSchemas = map[string]bool{
+	"information_schema": true,
+	"performance_schema": true,
+	"mysql":              true,
+	"sys":                true,
+	"public":             true,
+	"dbo":                true,
+	"guest":              true,
+}
+
+func isSharedSchema(name string) bool {
+	name = strings.ToLower(name)
+	return sharedSchemas[name] || strings.HasPrefix(name, "pg_") || strings.HasPrefix(name, "db_")
+}
+
+// TenantSchemas lists the schemas of the database, or the databases on
+// mysql, leaving out the system and default schemas
+func (c *Connection) TenantSchemas(ctx context.Context) ([]string, error) {
+	names := []string{}
+	stmt := "SELECT schema_name FROM information_schema.schemata ORDER BY schema_name"
+	if err := c.DB.selectMany(ctx, &names, stmt); err != nil {
+		return nil, errors.Wrap(err, "list schemas")
+	}
+	tenants := []string{}
+	for _, name := range names {
+		if !isSharedSchema(name) {
+			tenants = append(tenants, name)
+		}
+	}
+	return tenants, nil
+}
+
+// ForEachTenant calls fn with a connection scoped to each tenant in turn,
+// stopping at the first error. tenants defaults to TenantSchemas. tenants are
+// databases on mysql and schemas everywhere else.
+//
+//	err := conn.ForEachTenant(ctx, nil, func(tenant string, c *dasorm.Connection) error {
+//		return c.Create(&event)
+//	})
+func (c *Connection) ForEachTenant(ctx context.Context, tenants []string, fn func(tenant string, conn *Connection) error) error {
+	if tenants == nil {
+		var err error
+		if tenants, err = c.TenantSchemas(ctx); err != nil {
+			return err
+		}
+	}
+	for _, name := range tenants {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var (
+			scoped *Connection
+			err    error
+		)
+		if c.DialectName() == "mysql" {
+			scoped, err = c.WithDatabase(name)
+		} else {
+			scoped, err = c.WithSchema(name)
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(name, scoped); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	return nil
+}
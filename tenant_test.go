@@ -0,0 +1,221 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSchemaQualifiesTables(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	acme, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+
+	assert.NoError(t, acme.Create(&test{}))
+	assert.NoError(t, acme.All(&[]test{}))
+	assert.NoError(t, conn.All(&[]test{}))
+	assert.NoError(t, acme.Destroy(&test{}))
+	stmts := fake.Statements()
+	assert.True(t, strings.HasPrefix(stmts[0], "INSERT INTO acme.test "), stmts[0])
+	assert.Contains(t, stmts[1], "FROM acme.test")
+	assert.NotContains(t, stmts[2], "acme")
+	assert.True(t, strings.HasPrefix(stmts[3], "DELETE FROM acme.test "), stmts[3])
+
+	_, err = conn.WithSchema("acme; DROP TABLE users")
+	assert.Error(t, err)
+	_, err = conn.WithDatabase("other")
+	assert.EqualError(t, err, "postgres connection cannot switch databases without a config")
+}
+
+func TestTenantQualifier(t *testing.T) {
+	tests := []struct {
+		dialect  string
+		tenant   tenant
+		expected string
+	}{
+		{"mysql", tenant{database: "acme"}, "acme"},
+		{"mysql", tenant{schema: "acme"}, "acme"},
+		{"postgres", tenant{schema: "acme"}, "acme"},
+		{"mssql", tenant{database: "acme"}, "acme."},
+		{"mssql", tenant{database: "acme", schema: "sales"}, "acme.sales"},
+		{"snowflake", tenant{schema: "acme"}, "acme"},
+	}
+	for _, tt := range tests {
+		conn := &Connection{Dialect: MockDB(nil, tt.dialect).Dialect, tenant: tt.tenant}
+		assert.Equal(t, tt.expected, conn.qualifier(), tt.dialect)
+	}
+}
+
+func TestTenantPool(t *testing.T) {
+	conn, primary := newFakeConnection(t, "postgres")
+	var (
+		configs []*Config
+		fakes   []*fakeDB
+	)
+	connectConfig = func(config *Config) (*Connection, error) {
+		configs = append(configs, config)
+		c, fake := newFakeConnection(t, "postgres")
+		fakes = append(fakes, fake)
+		return c, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+	base := &Config{Dialect: "postgres", Database: "app"}
+	conn.DB.source = func(context.Context) (*Config, error) {
+		return base, nil
+	}
+
+	acme, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+	_, err = conn.WithSchema("acme")
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+	assert.Equal(t, "acme", configs[0].Options["search_path"])
+	assert.Nil(t, base.Options)
+
+	_, err = acme.Exec("SELECT 1")
+	assert.NoError(t, err)
+	tx, err := acme.Begin()
+	assert.NoError(t, err)
+	tx.Rollback()
+	assert.Equal(t, []string{"SELECT 1"}, fakes[0].Statements())
+	assert.Empty(t, primary.Statements())
+
+	other, err := acme.WithDatabase("other")
+	assert.NoError(t, err)
+	assert.Len(t, configs, 2)
+	assert.Equal(t, "other", configs[1].Database)
+	assert.Equal(t, "acme", configs[1].Options["search_path"])
+	assert.Equal(t, "acme", other.qualifier())
+
+	// the least recently used pool is closed past MaxTenantPools, once the
+	// transaction still using it is done
+	defer func(interval time.Duration) { drainInterval = interval }(drainInterval)
+	drainInterval = time.Millisecond
+	acmePool := conn.DB.tenants[tenant{schema: "acme"}.key()]
+	tx, err = acme.Begin()
+	assert.NoError(t, err)
+	for i := 0; i < MaxTenantPools; i++ {
+		_, err = conn.WithSchema(fmt.Sprintf("t%d", i))
+		assert.NoError(t, err)
+	}
+	assert.Len(t, conn.DB.tenants, MaxTenantPools)
+	assert.Nil(t, conn.DB.tenants[tenant{schema: "acme"}.key()])
+	time.Sleep(20 * time.Millisecond)
+	_, err = tx.Exec("SELECT 3")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Eventually(t, func() bool { return acmePool.Ping() != nil }, time.Second, time.Millisecond)
+	_, err = acme.Exec("SELECT 2")
+	assert.NoError(t, err)
+	assert.Len(t, configs, MaxTenantPools+3)
+	assert.Equal(t, []string{"SELECT 2"}, fakes[len(fakes)-1].Statements())
+
+	pool := conn.DB.tenants[tenant{schema: "acme"}.key()]
+	conn.Close()
+	assert.Error(t, pool.Ping())
+	_, err = conn.WithSchema("beta")
+	assert.EqualError(t, err, "beta: connection is closed")
+}
+
+func TestTenantPoolError(t *testing.T) {
+	conn, primary := newFakeConnection(t, "postgres")
+	fail := false
+	connectConfig = func(config *Config) (*Connection, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		c, _ := newFakeConnection(t, "postgres")
+		return c, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+	conn.DB.source = func(context.Context) (*Config, error) {
+		return &Config{Dialect: "postgres", Database: "app"}, nil
+	}
+	acme, err := conn.WithSchema("acme")
+	assert.NoError(t, err)
+
+	// the pool of the tenant is gone and cannot be opened again: nothing may
+	// fall back to the unscoped primary
+	conn.DB.mu.Lock()
+	conn.DB.tenants, conn.DB.tenantOrder = nil, nil
+	conn.DB.mu.Unlock()
+	fail = true
+	_, err = acme.Exec("DELETE FROM users")
+	assert.EqualError(t, err, "tenant acme: connection refused")
+	assert.EqualError(t, acme.Create(&test{}), "postgres create: tenant acme: connection refused")
+	assert.EqualError(t, acme.QueryRow("SELECT 1").Scan(new(int)), "tenant acme: connection refused")
+	_, err = acme.Query("SELECT 1")
+	assert.EqualError(t, err, "tenant acme: connection refused")
+	_, err = acme.Begin()
+	assert.EqualError(t, err, "tenant acme: connection refused")
+	_, err = acme.Conn(context.Background())
+	assert.EqualError(t, err, "tenant acme: connection refused")
+	assert.Empty(t, primary.Statements())
+}
+
+func TestTenantConfig(t *testing.T) {
+	mysql := tenantConfig(&Config{Dialect: "mysql", Database: "app"}, tenant{database: "acme"})
+	assert.Equal(t, "acme", mysql.Database)
+	snow := tenantConfig(&Config{Dialect: "snowflake", Database: "app"}, tenant{schema: "acme"})
+	assert.Equal(t, "app", snow.Database)
+	assert.Equal(t, "acme", snow.Options["schema"])
+	mssql := tenantConfig(&Config{Dialect: "microsoft_sql", Database: "app"}, tenant{database: "acme"})
+	assert.Equal(t, "acme", mssql.Database)
+	assert.Nil(t, tenantConfig(&Config{Dialect: "microsoft_sql", Database: "app"}, tenant{schema: "sales"}))
+}
+
+func TestTenantSharedPool(t *testing.T) {
+	conn, fake := newFakeConnection(t, "mssql")
+	calls := 0
+	conn.DB.source = func(context.Context) (*Config, error) {
+		calls++
+		return &Config{Dialect: "mssql", Database: "app"}, nil
+	}
+	sales, err := conn.WithSchema("sales")
+	assert.NoError(t, err)
+	assert.NoError(t, sales.Create(&test{}))
+	assert.NoError(t, sales.Create(&test{}))
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, conn.DB.tenantOrder)
+	assert.True(t, strings.HasPrefix(fake.Statements()[0], "INSERT INTO sales.test "), fake.Statements()[0])
+	conn.Close()
+}
+
+func TestForEachTenant(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	fake.columns = []string{"schema_name"}
+	fake.rows = [][]driver.Value{{"acme"}, {"beta"}, {"information_schema"}, {"pg_toast"}, {"public"}}
+
+	tenants, err := conn.TenantSchemas(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme", "beta"}, tenants)
+
+	visited := []string{}
+	err = conn.ForEachTenant(context.Background(), nil, func(tenant string, c *Connection) error {
+		visited = append(visited, tenant+":"+c.qualifier())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme:acme", "beta:beta"}, visited)
+
+	visited = []string{}
+	err = conn.ForEachTenant(context.Background(), []string{"one", "two"}, func(tenant string, c *Connection) error {
+		visited = append(visited, tenant)
+		return errors.New("boom")
+	})
+	assert.EqualError(t, err, "one: boom")
+	assert.Equal(t, []string{"one"}, visited)
+
+	mysql, _ := newFakeConnection(t, "mysql")
+	err = mysql.ForEachTenant(context.Background(), []string{"acme"}, func(name string, c *Connection) error {
+		assert.Equal(t, tenant{database: "acme"}, c.tenant)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,166 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// resetTimeout bounds clearing a server side timeout after the statement
+const resetTimeout = 5 * time.Second
+
+type timeoutKey struct{}
+
+// withTimeout returns ctx carrying the statement timeout of a query
+func withTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// statementTimeout returns the timeout of the statements run with ctx and
+// whether it is the timeout of a query rather than the connection's default
+func (db *DB) statementTimeout(ctx context.Context) (time.Duration, bool) {
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		return d, true
+	}
+	return db.StatementTimeout, false
+}
+
+// SetStatementTimeout limits how long every statement of the orm and of the
+// raw wrappers may run. zero disables the limit. the limit is a context
+// deadline; to also stop statements on the server, connect with the
+// statement_timeout option, which sets it for every session and is the
+// default statement timeout of the connection.
+func (c *Connection) SetStatementTimeout(d time.Duration) {
+	c.DB.StatementTimeout = d
+}
+
+// Timeout limits how long the statement of the query may run, overriding the
+// statement timeout of the connection
+//
+//	c.Where("status = ?", "open").Timeout(30 * time.Second).All(&jobs)
+func (q *Query) Timeout(d time.Duration) *Query {
+	q.timeout = d
+	return q
+}
+
+// queryer is what a pool and a transaction have in common
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// timed runs fn on the pool within the statement timeout of ctx. the limit is
+// a context deadline. the timeout of a query is also set on the server where
+// the dialect supports it, so the statement does not keep running once the
+// client gave up; the server side default is the statement_timeout option of
+// the sessions.
+func (db *DB) timed(ctx context.Context, stmt string, fn func(ctx context.Context, q queryer, stmt string) error) error {
+	timeout, query := db.statementTimeout(ctx)
+	if timeout <= 0 {
+		return fn(ctx, db.pool(), stmt)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var err error
+	if query {
+		err = db.timedServer(ctx, stmt, timeout, fn)
+	} else {
+		err = fn(ctx, db.pool(), stmt)
+	}
+	return timeoutError(ctx, err, timeout)
+}
+
+// timedRows is timed for a statement whose rows are read after it returns.
+// the deadline lasts until the timeout expires, not until the rows are
+// closed, and no server side timeout is set as the statement cannot be
+// wrapped in a transaction.
+func (db *DB) timedRows(ctx context.Context, fn func(ctx context.Context) error) error {
+	timeout, _ := db.statementTimeout(ctx)
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	limited, cancel := context.WithTimeout(ctx, timeout)
+	time.AfterFunc(timeout, cancel)
+	err := fn(limited)
+	// cancel may beat the deadline to ending limited
+	if err != nil && limited.Err() != nil && ctx.Err() == nil {
+		return errors.Wrapf(err, "statement timeout %s", timeout)
+	}
+	return err
+}
+
+// timeoutError marks err as caused by the statement timeout when the
+// deadline of ctx passed
+func timeoutError(ctx context.Context, err error, timeout time.Duration) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "statement timeout %s", timeout)
+	}
+	return err
+}
+
+// timedServer sets the server side timeout of a query. session settings are
+// made in a transaction, which pins one pooled connection, and cleared before
+// the connection goes back to the pool.
+func (db *DB) timedServer(ctx context.Context, stmt string, timeout time.Duration, fn func(ctx context.Context, q queryer, stmt string) error) error {
+	var set, reset string
+	switch db.dialect {
+	case "mysql":
+		stmt = mysqlTimeoutHint(stmt, timeout)
+	case "postgres":
+		set = fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())
+	case "snowflake":
+		set = fmt.Sprintf("ALTER SESSION SET STATEMENT_TIMEOUT_IN_SECONDS = %d", ceilSeconds(timeout))
+		reset = "ALTER SESSION UNSET STATEMENT_TIMEOUT_IN_SECONDS"
+	}
+	if set == "" {
+		return fn(ctx, db.pool(), stmt)
+	}
+	// the transaction outlives ctx so the setting can be cleared after a
+	// statement that timed out
+	txCtx, cancel := context.WithTimeout(context.Background(), timeout+resetTimeout)
+	defer cancel()
+	tx, err := db.pool().BeginTxx(txCtx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, set); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "set statement timeout")
+	}
+	err = fn(ctx, tx, stmt)
+	if reset != "" {
+		if _, rerr := tx.ExecContext(txCtx, reset); rerr != nil {
+			log.Printf("[dasorm] reset statement timeout: %v", rerr)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// mysqlTimeoutHint adds the MAX_EXECUTION_TIME optimizer hint to a select.
+// mysql ignores the hint on any other statement.
+func mysqlTimeoutHint(stmt string, timeout time.Duration) string {
+	trimmed := strings.TrimLeft(stmt, " \t\r\n")
+	if len(trimmed) < 6 || !strings.EqualFold(trimmed[:6], "SELECT") {
+		return stmt
+	}
+	return fmt.Sprintf("SELECT /*+ MAX_EXECUTION_TIME(%d) */%s", timeout.Milliseconds(), trimmed[6:])
+}
+
+// ceilSeconds rounds d up to whole seconds, at least one
+func ceilSeconds(d time.Duration) int64 {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		return 1
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package dasorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	conn, fake := newFakeConnection(t, "mssql")
+	fake.delay = time.Second
+	start := time.Now()
+	err := conn.Where("id = ?", 1).Timeout(20 * time.Millisecond).All(&[]test{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "statement timeout 20ms")
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	conn.SetStatementTimeout(20 * time.Millisecond)
+	assert.Error(t, conn.Create(&test{}))
+	_, err = conn.Exec("UPDATE test SET x = 1")
+	assert.Error(t, err)
+
+	// the query timeout overrides the default
+	fake.delay = 50 * time.Millisecond
+	assert.NoError(t, Q(conn).Timeout(time.Second).All(&[]test{}))
+}
+
+func TestRawQueryTimeout(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	fake.delay = time.Second
+	conn.SetStatementTimeout(20 * time.Millisecond)
+	start := time.Now()
+	_, err := conn.Query("SELECT 1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "statement timeout 20ms")
+	assert.Error(t, conn.QueryRow("SELECT 1").Scan(new(int)))
+	_, err = conn.QueryContext(context.Background(), "SELECT 1")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	// the rows outlive the call that returned them
+	fake.delay = 0
+	fake.columns = []string{"n"}
+	fake.rows = [][]driver.Value{{int64(1)}}
+	rows, err := conn.Query("SELECT n")
+	assert.NoError(t, err)
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Close())
+}
+
+func TestServerTimeout(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	conn.SetStatementTimeout(1500 * time.Millisecond)
+	assert.NoError(t, conn.Where("id = ?", 1).All(&[]test{}))
+	assert.Len(t, fake.Statements(), 1, "the default is left to the statement_timeout option")
+
+	assert.NoError(t, conn.Where("id = ?", 1).Timeout(1500*time.Millisecond).All(&[]test{}))
+	stmts := fake.Statements()[1:]
+	assert.Equal(t, "SET LOCAL statement_timeout = 1500", stmts[0])
+	assert.Contains(t, stmts[1], "SELECT")
+
+	snow, fake := newFakeConnection(t, "snowflake")
+	assert.NoError(t, snow.Where("id = ?", 1).Timeout(1500*time.Millisecond).All(&[]test{}))
+	stmts = fake.Statements()
+	assert.Len(t, stmts, 3)
+	assert.Equal(t, "ALTER SESSION SET STATEMENT_TIMEOUT_IN_SECONDS = 2", stmts[0])
+	assert.Contains(t, stmts[1], "SELECT")
+	assert.Equal(t, "ALTER SESSION UNSET STATEMENT_TIMEOUT_IN_SECONDS", stmts[2])
+
+	my, fake := newFakeConnection(t, "mysql")
+	assert.NoError(t, Q(my).Timeout(250*time.Millisecond).All(&[]test{}))
+	assert.Contains(t, fake.Statements()[0], "SELECT /*+ MAX_EXECUTION_TIME(250) */ ")
+}
+
+func TestMySQLTimeoutHint(t *testing.T) {
+	assert.Equal(t, "SELECT /*+ MAX_EXECUTION_TIME(100) */ * FROM t", mysqlTimeoutHint("  select * FROM t", 100*time.Millisecond))
+	assert.Equal(t, "DELETE FROM t", mysqlTimeoutHint("DELETE FROM t", time.Second))
+	assert.Equal(t, int64(1), ceilSeconds(time.Millisecond))
+}
@@ -0,0 +1,212 @@
+package dasorm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/estenssoros/dasorm/nulls"
+	"github.com/pkg/errors"
+)
+
+// transitPrefix starts every ciphertext produced by the transit engine
+const transitPrefix = "vault:v"
+
+// transitMount returns the mount of the transit engine, VAULT_TRANSIT_MOUNT
+// or transit
+func transitMount() string {
+	return mountPath(os.Getenv("VAULT_TRANSIT_MOUNT"), "transit")
+}
+
+// encryptedField is a string or nulls.String field tagged encrypt=<key>
+type encryptedField struct {
+	value reflect.Value
+}
+
+func (f encryptedField) get() (string, bool) {
+	if ns, ok := f.value.Addr().Interface().(*nulls.String); ok {
+		return ns.String, ns.Valid && ns.String != ""
+	}
+	s := f.value.String()
+	return s, s != ""
+}
+
+func (f encryptedField) set(s string) {
+	if ns, ok := f.value.Addr().Interface().(*nulls.String); ok {
+		ns.String = s
+		return
+	}
+	f.value.SetString(s)
+}
+
+// encryptKeys returns the transit key of each encrypted field index of t
+func encryptKeys(t reflect.Type) (map[int]string, error) {
+	keys := map[int]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, ok := tagOption(f, "encrypt")
+		if !ok || f.Tag.Get("db") == "" {
+			continue
+		}
+		if f.Type.Kind() != reflect.String && f.Type != reflect.TypeOf(nulls.String{}) {
+			return nil, errors.Errorf("%s: only string fields can be encrypted", f.Name)
+		}
+		if key == "" {
+			return nil, errors.Errorf("%s: missing transit key", f.Name)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// encryptedFields groups the non empty encrypted fields of a model or slice
+// of models by transit key
+func (m *Model) encryptedFields() (map[string][]encryptedField, error) {
+	t := reflect.TypeOf(m.Value)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	keys, err := encryptKeys(t)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	fields := map[string][]encryptedField{}
+	add := func(v reflect.Value) {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return
+			}
+			v = v.Elem()
+		}
+		for i, key := range keys {
+			f := encryptedField{value: v.Field(i)}
+			if _, ok := f.get(); ok {
+				fields[key] = append(fields[key], f)
+			}
+		}
+	}
+	v := reflect.Indirect(reflect.ValueOf(m.Value))
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			add(v.Index(i))
+		}
+	} else {
+		add(v)
+	}
+	return fields, nil
+}
+
+// encrypt replaces the encrypted fields of the model with their ciphertext,
+// one transit request per key. the returned func restores the plaintext.
+func (m *Model) encrypt() (func(), error) {
+	fields, err := m.encryptedFields()
+	if err != nil {
+		return nil, err
+	}
+	restore := func() {}
+	for key, fs := range fields {
+		plaintexts := make([]string, len(fs))
+		for i, f := range fs {
+			plaintexts[i], _ = f.get()
+		}
+		ciphertexts, err := transit("encrypt", key, plaintexts)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		for i, f := range fs {
+			f.set(ciphertexts[i])
+		}
+		prev, fs := restore, fs
+		restore = func() {
+			prev()
+			for i, f := range fs {
+				f.set(plaintexts[i])
+			}
+		}
+	}
+	return restore, nil
+}
+
+// decrypt replaces the ciphertext in the encrypted fields of the model with
+// the plaintext, one transit request per key. values that were not encrypted
+// by transit are left untouched.
+func (m *Model) decrypt() error {
+	fields, err := m.encryptedFields()
+	if err != nil {
+		return err
+	}
+	for key, fs := range fields {
+		encrypted := []encryptedField{}
+		ciphertexts := []string{}
+		for _, f := range fs {
+			if s, _ := f.get(); strings.HasPrefix(s, transitPrefix) {
+				encrypted = append(encrypted, f)
+				ciphertexts = append(ciphertexts, s)
+			}
+		}
+		if len(ciphertexts) == 0 {
+			continue
+		}
+		plaintexts, err := transit("decrypt", key, ciphertexts)
+		if err != nil {
+			return err
+		}
+		for i, f := range encrypted {
+			f.set(plaintexts[i])
+		}
+	}
+	return nil
+}
+
+// transit sends a batch of values to the encrypt or decrypt endpoint of a
+// transit key
+func transit(op, key string, values []string) ([]string, error) {
+	client, err := connectVault()
+	if err != nil {
+		return nil, errors.Wrap(err, "connect vault")
+	}
+	batch := make([]map[string]interface{}, len(values))
+	for i, v := range values {
+		if op == "encrypt" {
+			batch[i] = map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString([]byte(v))}
+		} else {
+			batch[i] = map[string]interface{}{"ciphertext": v}
+		}
+	}
+	path := transitMount() + "/" + op + "/" + key
+	secret, err := client.Logical().Write(path, map[string]interface{}{"batch_input": batch})
+	if err != nil {
+		return nil, errors.Wrapf(err, "transit %s %s", op, key)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("vault error: no data at: %s", path)
+	}
+	results, _ := secret.Data["batch_results"].([]interface{})
+	if len(results) != len(values) {
+		return nil, errors.Errorf("transit %s %s: expected %d results, got %d", op, key, len(values), len(results))
+	}
+	out := make([]string, len(values))
+	for i, r := range results {
+		result, _ := r.(map[string]interface{})
+		if msg, _ := result["error"].(string); msg != "" {
+			return nil, errors.Errorf("transit %s %s: %s", op, key, msg)
+		}
+		if op == "encrypt" {
+			out[i], _ = result["ciphertext"].(string)
+			continue
+		}
+		plaintext, _ := result["plaintext"].(string)
+		b, err := base64.StdEncoding.DecodeString(plaintext)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transit decrypt %s", key)
+		}
+		out[i] = string(b)
+	}
+	return out, nil
+}
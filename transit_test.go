@@ -0,0 +1,105 @@
+package dasorm
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/estenssoros/dasorm/nulls"
+	"github.com/stretchr/testify/assert"
+)
+
+type patient struct {
+	ID    int          `db:"id"`
+	Email string       `db:"email" dasorm:"encrypt=pii"`
+	Note  nulls.String `db:"note" dasorm:"sensitive,encrypt=notes"`
+}
+
+func (patient) TableName() string { return "patients" }
+
+// newTransitServer fakes the transit engine. ciphertexts are the base64
+// plaintext behind the vault prefix.
+func newTransitServer(t *testing.T) *[]string {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			BatchInput []map[string]string `json:"batch_input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, strings.TrimPrefix(r.URL.Path, "/v1/transit/"))
+		mu.Unlock()
+		results := []map[string]string{}
+		for _, in := range body.BatchInput {
+			if p, ok := in["plaintext"]; ok {
+				results = append(results, map[string]string{"ciphertext": "vault:v1:" + p})
+			} else {
+				results = append(results, map[string]string{"plaintext": strings.TrimPrefix(in["ciphertext"], "vault:v1:")})
+			}
+		}
+		writeVaultJSON(w, map[string]interface{}{"data": map[string]interface{}{"batch_results": results}})
+	}
+	newVaultServer(t, map[string]http.HandlerFunc{"/v1/transit/": handler})
+	SetVaultAuth(TokenAuth{Token: "t"})
+	return &requests
+}
+
+func TestTransitCreate(t *testing.T) {
+	requests := newTransitServer(t)
+	conn, fake := newFakeConnection(t, "mysql")
+
+	patients := []patient{
+		{Email: "a@example.com", Note: nulls.NewString("allergic")},
+		{Email: "b@example.com"},
+	}
+	assert.NoError(t, conn.CreateMany(&patients))
+	assert.Equal(t, "a@example.com", patients[0].Email, "the caller keeps the plaintext")
+	assert.Equal(t, "allergic", patients[0].Note.String)
+
+	stmts := fake.Statements()
+	assert.Len(t, stmts, 1)
+	assert.Contains(t, stmts[0], "vault:v1:"+base64.StdEncoding.EncodeToString([]byte("a@example.com")))
+	assert.NotContains(t, stmts[0], "a@example.com")
+	assert.NotContains(t, stmts[0], "allergic")
+	assert.ElementsMatch(t, []string{"encrypt/pii", "encrypt/notes"}, *requests)
+}
+
+func TestTransitSelect(t *testing.T) {
+	requests := newTransitServer(t)
+	conn, fake := newFakeConnection(t, "mysql")
+	fake.columns = []string{"id", "email", "note"}
+	fake.rows = [][]driver.Value{
+		{int64(1), "vault:v1:" + base64.StdEncoding.EncodeToString([]byte("a@example.com")), nil},
+		{int64(2), "legacy@example.com", "vault:v1:" + base64.StdEncoding.EncodeToString([]byte("note"))},
+	}
+
+	patients := []patient{}
+	assert.NoError(t, conn.All(&patients))
+	assert.Equal(t, "a@example.com", patients[0].Email)
+	assert.Equal(t, "legacy@example.com", patients[1].Email, "values not encrypted by transit are kept")
+	assert.Equal(t, nulls.NewString("note"), patients[1].Note)
+	assert.ElementsMatch(t, []string{"decrypt/pii", "decrypt/notes"}, *requests)
+
+	p := patient{}
+	assert.NoError(t, conn.First(&p))
+	assert.Equal(t, "a@example.com", p.Email)
+}
+
+func TestEncryptKeys(t *testing.T) {
+	type bad struct {
+		Age int `db:"age" dasorm:"encrypt=pii"`
+	}
+	_, err := (&Model{Value: &bad{Age: 1}}).encryptedFields()
+	assert.EqualError(t, err, "Age: only string fields can be encrypted")
+
+	restore, err := (&Model{Value: &test{}}).encrypt()
+	assert.NoError(t, err)
+	restore()
+}
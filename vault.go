@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/api"
@@ -41,129 +44,238 @@ func getVaultToken() (string, error) {
 	return string(file), nil
 }
 
-// connect to vault
+// connect to vault with the configured auth method
 func connectVault() (*api.Client, error) {
-	token, err := getVaultToken()
+	return session.connect()
+}
+
+// use vault api and reflect to populate config struct
+func getConfigVault(environment string) (*Config, error) {
+	return getConfigVaultVersion(environment, 0)
+}
+
+// getConfigVaultVersion reads a version of an environment's config. version 0
+// reads the latest.
+func getConfigVaultVersion(environment string, version int) (*Config, error) {
+	client, err := connectVault()
 	if err != nil {
 		return nil, err
 	}
-	vaultAddr, err := getEnv("VAULT_ADDR")
+	kv, err := vaultKV()
 	if err != nil {
 		return nil, err
 	}
-
-	client, err := api.NewClient(&api.Config{
-		Address: vaultAddr,
-	})
+	dataMap, err := kv.read(client, kv.configPath(environment), version)
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(token)
-	return client, nil
+	return configFromMap(dataMap, "vault response")
 }
 
-// use vault api and reflect to populate config struct
-func getConfigVault(environment string) (*Config, error) {
-	client, err := connectVault()
-	if err != nil {
+// configFromMap populates a config from a map keyed by the vault tags
+func configFromMap(dataMap map[string]interface{}, source string) (*Config, error) {
+	config := &Config{}
+	if err := decodeVault(dataMap, config, source); err != nil {
 		return nil, err
 	}
-	secret, err := client.Logical().Read(fmt.Sprintf("secret/data/%s/database", environment))
-	if err != nil {
-		return nil, err
+	return config, nil
+}
+
+// decodeVault sets the fields of the struct pointed to by out from a map
+// keyed by their vault tags. fields without a tag or tagged "-" are skipped.
+func decodeVault(dataMap map[string]interface{}, out interface{}, source string) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("vault decode: expected a pointer to a struct, got %T", out)
 	}
-	if secret == nil {
-		return nil, fmt.Errorf("vault error: no data at: %s", environment)
+	vals := v.Elem()
+	typ := vals.Type()
+	for i := 0; i < vals.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("vault")
+		if tag == "" || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		tagName, optional := parseVaultTag(tag)
+		val, ok := dataMap[tagName]
+		if !ok || val == nil {
+			if optional {
+				continue
+			}
+			return fmt.Errorf("could not locate %s in %s", f.Name, source)
+		}
+		if err := setVaultField(vals.Field(i), val); err != nil {
+			return errors.Wrap(err, f.Name)
+		}
 	}
+	return nil
+}
 
-	dataMap, ok := secret.Data["data"].(map[string]interface{})
-	if !ok {
-		return nil, errors.New("failed to parse data from vault response")
+// parseVaultTag splits a vault tag into its key and whether it is optional
+func parseVaultTag(tag string) (string, bool) {
+	parts := strings.Split(tag, ",")
+	optional := false
+	for _, opt := range parts[1:] {
+		if opt == "optional" {
+			optional = true
+		}
 	}
+	return parts[0], optional
+}
 
-	config := &Config{}
-	configVals := reflect.ValueOf(config).Elem()
-	configType := configVals.Type()
+// vaultStringMap reads a map stored either as a json object or as a url
+// encoded query string
+func vaultStringMap(val interface{}) (map[string]string, error) {
+	out := map[string]string{}
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			out[key] = fmt.Sprintf("%v", val)
+		}
+	case string:
+		query, err := url.ParseQuery(v)
+		if err != nil {
+			return nil, err
+		}
+		for key := range query {
+			out[key] = query.Get(key)
+		}
+	default:
+		return nil, errors.Errorf("cannot read %T as a map", val)
+	}
+	return out, nil
+}
 
-	for i := 0; i < configVals.NumField(); i++ {
-		f := configType.Field(i)
-		tagName := f.Tag.Get("vault")
-		if tagName == "" {
-			return nil, errors.Errorf("unknown field in vault config: %s", f.Name)
+// vaultStrings reads a list stored either as a json array or as a comma
+// separated string
+func vaultStrings(val interface{}) []string {
+	out := []string{}
+	switch v := val.(type) {
+	case []interface{}:
+		for _, val := range v {
+			out = append(out, fmt.Sprintf("%v", val))
 		}
-		val, ok := dataMap[tagName]
-		if !ok {
-			return nil, fmt.Errorf("could not locate %s in vault response", f.Name)
+	default:
+		for _, s := range strings.Split(fmt.Sprintf("%v", val), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
 		}
-		configVals.Field(i).SetString(val.(string))
 	}
-	return config, nil
+	return out
+}
+
+// setVaultField converts a value read from vault to the type of field
+func setVaultField(field reflect.Value, val interface{}) error {
+	str := fmt.Sprintf("%v", val)
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Type() == reflect.TypeOf(map[string]string{}):
+		m, err := vaultStringMap(val)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(m))
+	case field.Type() == reflect.TypeOf([]string{}):
+		field.Set(reflect.ValueOf(vaultStrings(val)))
+	case field.Kind() == reflect.String:
+		field.SetString(str)
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() >= reflect.Uint && field.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case field.Kind() == reflect.Float32, field.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return errors.Errorf("unsupported vault field type %s", field.Type())
+	}
+	return nil
 }
 
-// GetConfigVault uses a context to attempt to connect to vault
+// GetConfigVault uses a context to attempt to connect to vault. configs are
+// cached in VaultCache.
 func GetConfigVault(environment string) (*Config, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	ch := make(chan struct {
-		conn *Config
-		err  error
-	})
-
-	go func() {
-		conn, err := getConfigVault(environment)
-		ch <- struct {
-			conn *Config
-			err  error
-		}{conn, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case pack := <-ch:
-		if pack.err != nil {
-			return nil, pack.err
-		}
-		return pack.conn, nil
-	}
+	return GetConfigVaultContext(ctx, environment)
+}
 
+// GetConfigVaultContext reads an environment's config from VaultCache,
+// giving up when ctx is done
+func GetConfigVaultContext(ctx context.Context, environment string) (*Config, error) {
+	return VaultCache.Config(ctx, environment)
 }
 
-//AWSCreds stores the creds for an aws user
-type AWSCreds struct {
-	ID  string
-	Key string
+// GetConfigVaultVersion reads a specific version of an environment's config
+// from a kv v2 mount
+func GetConfigVaultVersion(environment string, version int) (*Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return VaultProvider{Version: version}.Config(ctx, environment)
 }
 
-//GetAWSCreds returns the creds for logging
-func GetAWSCreds(service string) (*AWSCreds, error) {
+// ReadSecret reads the kv secret at path under the configured kv mount (see
+// SetVaultKV) into the struct pointed to by out. fields are matched by their
+// vault tags; a missing field is an error unless its tag ends in ",optional".
+//
+//	type APIKeys struct {
+//		Stripe string `vault:"stripe_key"`
+//		Sentry string `vault:"sentry_dsn,optional"`
+//	}
+func ReadSecret(path string, out interface{}) error {
 	client, err := connectVault()
 	if err != nil {
-		return nil, errors.Wrap(err, "connect vault")
+		return errors.Wrap(err, "connect vault")
 	}
-
-	secrets, err := client.Logical().Read(fmt.Sprintf("secret/data/%s", service))
+	kv, err := vaultKV()
 	if err != nil {
-		return nil, errors.Wrap(err, "client read")
+		return err
 	}
-
-	if secrets == nil {
-		return nil, fmt.Errorf("vault errror: no data at: %s", service)
+	data, err := kv.read(client, strings.Trim(path, "/"), 0)
+	if err != nil {
+		return errors.Wrap(err, "client read")
 	}
+	return decodeVault(data, out, "secret "+path)
+}
 
-	secret := secrets.Data["data"].(map[string]interface{})
+//AWSCreds stores the creds for an aws user
+type AWSCreds struct {
+	ID  string `vault:"aws_id"`
+	Key string `vault:"aws_key"`
+	// Token is the session token of temporary credentials
+	Token string `vault:"aws_token,optional"`
+	// Expires is when credentials leased from the aws secrets engine expire
+	Expires time.Time `vault:"-"`
+}
 
+//GetAWSCreds returns the creds for logging
+func GetAWSCreds(service string) (*AWSCreds, error) {
 	creds := &AWSCreds{}
-	if val, ok := secret["aws_id"]; !ok {
-		panic(errors.New("Could not locate aws credentials"))
-	} else {
-		creds.ID = val.(string)
-	}
-	if val, ok := secret["aws_key"]; !ok {
-		panic(errors.New("Could not locate aws credentials"))
-	} else {
-		creds.Key = val.(string)
+	if err := ReadSecret(service, creds); err != nil {
+		return nil, err
 	}
-
 	return creds, nil
 }
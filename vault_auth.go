@@ -0,0 +1,317 @@
+package dasorm
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// defaultKubernetesJWTPath is where kubernetes mounts the service account token
+const defaultKubernetesJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultReloginInterval is the wait after a failed login attempt while
+// renewing, doubled after every further failure up to vaultReloginMaxInterval
+var (
+	vaultReloginInterval    = 5 * time.Second
+	vaultReloginMaxInterval = 5 * time.Minute
+)
+
+// VaultAuth logs in to vault and returns the resulting auth secret
+type VaultAuth interface {
+	Login(client *api.Client) (*api.Secret, error)
+}
+
+// TokenAuth uses a static token
+type TokenAuth struct {
+	Token string
+}
+
+// Login returns the static token
+func (a TokenAuth) Login(client *api.Client) (*api.Secret, error) {
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: strings.TrimSpace(a.Token)}}, nil
+}
+
+// AppRoleAuth logs in with the approle auth method
+type AppRoleAuth struct {
+	RoleID    string
+	SecretID  string
+	MountPath string
+}
+
+// Login logs in with the role and secret id
+func (a AppRoleAuth) Login(client *api.Client) (*api.Secret, error) {
+	return vaultLogin(client, mountPath(a.MountPath, "approle"), "", map[string]interface{}{
+		"role_id":   a.RoleID,
+		"secret_id": a.SecretID,
+	})
+}
+
+// KubernetesAuth logs in with the kubernetes auth method using the pod's
+// service account token
+type KubernetesAuth struct {
+	Role      string
+	JWTPath   string
+	MountPath string
+}
+
+// Login logs in with the service account token
+func (a KubernetesAuth) Login(client *api.Client) (*api.Secret, error) {
+	jwtPath := a.JWTPath
+	if jwtPath == "" {
+		jwtPath = defaultKubernetesJWTPath
+	}
+	jwt, err := ioutil.ReadFile(jwtPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read service account token")
+	}
+	return vaultLogin(client, mountPath(a.MountPath, "kubernetes"), "", map[string]interface{}{
+		"role": a.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+}
+
+// UserpassAuth logs in with the userpass auth method
+type UserpassAuth struct {
+	Username  string
+	Password  string
+	MountPath string
+}
+
+// Login logs in with the username and password
+func (a UserpassAuth) Login(client *api.Client) (*api.Secret, error) {
+	return vaultLogin(client, mountPath(a.MountPath, "userpass"), a.Username, map[string]interface{}{
+		"password": a.Password,
+	})
+}
+
+func mountPath(path, def string) string {
+	if path == "" {
+		path = def
+	}
+	return strings.Trim(path, "/")
+}
+
+// vaultLogin writes a login request to auth/<mount>/login[/<name>]
+func vaultLogin(client *api.Client, mount, name string, data map[string]interface{}) (*api.Secret, error) {
+	path := "auth/" + mount + "/login"
+	if name != "" {
+		path += "/" + name
+	}
+	secret, err := client.Logical().Write(path, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "vault login %s", mount)
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.Errorf("vault login %s: no auth info returned", mount)
+	}
+	return secret, nil
+}
+
+// vaultAuthFromEnv picks an auth method from the environment
+//
+//	VAULT_ROLE_ID, VAULT_SECRET_ID  approle
+//	VAULT_K8S_ROLE                  kubernetes (VAULT_K8S_TOKEN_PATH overrides the token path)
+//	VAULT_USERNAME, VAULT_PASSWORD  userpass
+//
+// VAULT_AUTH_PATH overrides the mount path of the method. without any of these
+// the token from ~/.vault-token or VAULT_TOKEN is used.
+func vaultAuthFromEnv() (VaultAuth, error) {
+	mount := os.Getenv("VAULT_AUTH_PATH")
+	if roleID := os.Getenv("VAULT_ROLE_ID"); roleID != "" {
+		secretID, err := getEnv("VAULT_SECRET_ID")
+		if err != nil {
+			return nil, err
+		}
+		return AppRoleAuth{RoleID: roleID, SecretID: secretID, MountPath: mount}, nil
+	}
+	if role := os.Getenv("VAULT_K8S_ROLE"); role != "" {
+		return KubernetesAuth{Role: role, JWTPath: os.Getenv("VAULT_K8S_TOKEN_PATH"), MountPath: mount}, nil
+	}
+	if username := os.Getenv("VAULT_USERNAME"); username != "" {
+		password, err := getEnv("VAULT_PASSWORD")
+		if err != nil {
+			return nil, err
+		}
+		return UserpassAuth{Username: username, Password: password, MountPath: mount}, nil
+	}
+	token, err := getVaultToken()
+	if err != nil {
+		return nil, err
+	}
+	return TokenAuth{Token: token}, nil
+}
+
+// vaultSession caches a client logged in with an auth method and keeps its
+// token renewed in the background
+type vaultSession struct {
+	mu     sync.Mutex
+	auth   VaultAuth
+	client *api.Client
+	stop   chan struct{}
+	// expires is when a client with a token that cannot be renewed logs in
+	// again, zero for renewed tokens and tokens without a ttl
+	expires time.Time
+}
+
+var session = &vaultSession{}
+
+// SetVaultAuth sets the auth method used to connect to vault. a nil auth
+// picks the method from the environment.
+func SetVaultAuth(auth VaultAuth) {
+	session.close()
+	session.mu.Lock()
+	session.auth = auth
+	session.mu.Unlock()
+}
+
+// StopVaultRenewal stops renewing the vault token and forgets the logged in client
+func StopVaultRenewal() {
+	session.close()
+}
+
+func (s *vaultSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.client = nil
+	s.expires = time.Time{}
+}
+
+// newVaultClient creates a client for VAULT_ADDR in VAULT_NAMESPACE
+func newVaultClient() (*api.Client, error) {
+	vaultAddr, err := getEnv("VAULT_ADDR")
+	if err != nil {
+		return nil, err
+	}
+	client, err := api.NewClient(&api.Config{
+		Address: vaultAddr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		client.SetNamespace(ns)
+	}
+	return client, nil
+}
+
+// connect returns a logged in client. static tokens are read on every call
+// so that a refreshed ~/.vault-token is picked up; login methods are cached,
+// until two thirds of the ttl of a token that cannot be renewed have passed.
+func (s *vaultSession) connect() (*api.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil && (s.expires.IsZero() || time.Now().Before(s.expires)) {
+		return s.client, nil
+	}
+	s.client, s.expires = nil, time.Time{}
+	auth := s.auth
+	if auth == nil {
+		var err error
+		if auth, err = vaultAuthFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	client, err := newVaultClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := auth.Login(client)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(secret.Auth.ClientToken)
+	if _, ok := auth.(TokenAuth); ok {
+		return client, nil
+	}
+	s.client = client
+	if secret.Auth.Renewable {
+		s.stop = make(chan struct{})
+		go s.renew(client, auth, secret, s.stop)
+	} else if ttl := secret.Auth.LeaseDuration; ttl > 0 {
+		s.expires = time.Now().Add(time.Duration(ttl) * time.Second * 2 / 3)
+	}
+	return client, nil
+}
+
+// renew keeps the client's token alive. renewable tokens are renewed until
+// they no longer can be, tokens that cannot be renewed are replaced after two
+// thirds of their ttl, as in connect; either way by logging in again.
+func (s *vaultSession) renew(client *api.Client, auth VaultAuth, secret *api.Secret, stop chan struct{}) {
+	for {
+		if secret.Auth.Renewable {
+			renewer, err := client.NewRenewer(&api.RenewerInput{Secret: secret})
+			if err != nil {
+				log.Printf("[dasorm] vault token renewal: %v", err)
+				return
+			}
+			go renewer.Renew()
+			if !waitRenewer(renewer, stop) {
+				return
+			}
+		} else {
+			ttl := time.Duration(secret.Auth.LeaseDuration) * time.Second
+			if ttl <= 0 {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(ttl * 2 / 3):
+			}
+		}
+		if secret = vaultRelogin(client, auth, stop); secret == nil {
+			return
+		}
+		client.SetToken(secret.Auth.ClientToken)
+	}
+}
+
+// vaultRelogin logs in until it succeeds, doubling the wait after each
+// failure up to vaultReloginMaxInterval. it returns nil if stop is closed
+// first.
+func vaultRelogin(client *api.Client, auth VaultAuth, stop chan struct{}) *api.Secret {
+	wait := vaultReloginInterval
+	for {
+		secret, err := auth.Login(client)
+		if err == nil {
+			return secret
+		}
+		log.Printf("[dasorm] vault login: %v", err)
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(wait):
+		}
+		if wait *= 2; wait > vaultReloginMaxInterval {
+			wait = vaultReloginMaxInterval
+		}
+	}
+}
+
+// waitRenewer blocks until the renewer gives up or stop is closed. it
+// reports whether a new login is needed.
+func waitRenewer(renewer *api.Renewer, stop chan struct{}) bool {
+	defer renewer.Stop()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-renewer.RenewCh():
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				log.Printf("[dasorm] vault renewal: %v", err)
+			}
+			return true
+		}
+	}
+}
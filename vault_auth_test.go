@@ -0,0 +1,175 @@
+package dasorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newVaultServer starts a fake vault that answers with the given handlers.
+// handler paths ending in a slash match every path below them.
+func newVaultServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.URL.Path]
+		for prefix, handler := range handlers {
+			if !ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(r.URL.Path, prefix) {
+				h, ok = handler, true
+			}
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		h(w, r)
+	}))
+	os.Setenv("VAULT_ADDR", server.URL)
+	t.Cleanup(func() {
+		server.Close()
+		os.Unsetenv("VAULT_ADDR")
+		SetVaultAuth(nil)
+	})
+	return server
+}
+
+func writeVaultJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestAppRoleAuth(t *testing.T) {
+	var body map[string]interface{}
+	var namespace string
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/approle/login": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			namespace = r.Header.Get("X-Vault-Namespace")
+			writeVaultJSON(w, map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "s.approle", "renewable": false},
+			})
+		},
+	})
+	os.Setenv("VAULT_NAMESPACE", "team")
+	defer os.Unsetenv("VAULT_NAMESPACE")
+
+	SetVaultAuth(AppRoleAuth{RoleID: "role", SecretID: "secret"})
+	client, err := connectVault()
+	assert.NoError(t, err)
+	assert.Equal(t, "s.approle", client.Token())
+	assert.Equal(t, map[string]interface{}{"role_id": "role", "secret_id": "secret"}, body)
+	assert.Equal(t, "team", namespace)
+
+	again, err := connectVault()
+	assert.NoError(t, err)
+	assert.True(t, client == again, "login methods should reuse the client")
+}
+
+func TestNonRenewableRelogin(t *testing.T) {
+	logins := 0
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/approle/login": func(w http.ResponseWriter, r *http.Request) {
+			logins++
+			writeVaultJSON(w, map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": fmt.Sprintf("s.batch%d", logins), "renewable": false, "lease_duration": 1},
+			})
+		},
+	})
+	SetVaultAuth(AppRoleAuth{RoleID: "role", SecretID: "secret"})
+	client, err := connectVault()
+	assert.NoError(t, err)
+	assert.Equal(t, "s.batch1", client.Token())
+	client, err = connectVault()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logins)
+
+	// the token expires after a second, the session logs in again before that
+	time.Sleep(700 * time.Millisecond)
+	client, err = connectVault()
+	assert.NoError(t, err)
+	assert.Equal(t, "s.batch2", client.Token())
+	assert.Equal(t, 2, logins)
+}
+
+func TestRenewRelogin(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/approle/login": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			logins++
+			n := logins
+			mu.Unlock()
+			if n == 2 {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"errors":["sealed"]}`))
+				return
+			}
+			writeVaultJSON(w, map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": fmt.Sprintf("s.%d", n), "renewable": n == 1, "lease_duration": 60},
+			})
+		},
+		"/v1/auth/token/renew-self": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+		},
+	})
+	defer func(interval time.Duration) { vaultReloginInterval = interval }(vaultReloginInterval)
+	vaultReloginInterval = 10 * time.Millisecond
+
+	// the renewable token cannot be renewed, the first login after it fails
+	// and the token of the next one is not renewable: it is kept until two
+	// thirds of its ttl instead of logging in over and over
+	SetVaultAuth(AppRoleAuth{RoleID: "role", SecretID: "secret"})
+	client, err := connectVault()
+	assert.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, 3, logins)
+	mu.Unlock()
+	assert.Equal(t, "s.3", client.Token())
+}
+
+func TestUserpassAuth(t *testing.T) {
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/ldap/login/bob": func(w http.ResponseWriter, r *http.Request) {
+			writeVaultJSON(w, map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": "s.userpass"},
+			})
+		},
+	})
+	SetVaultAuth(UserpassAuth{Username: "bob", Password: "pass", MountPath: "/ldap/"})
+	client, err := connectVault()
+	assert.NoError(t, err)
+	assert.Equal(t, "s.userpass", client.Token())
+}
+
+func TestVaultAuthFromEnv(t *testing.T) {
+	os.Setenv("VAULT_ROLE_ID", "role")
+	os.Setenv("VAULT_SECRET_ID", "secret")
+	os.Setenv("VAULT_AUTH_PATH", "my-approle")
+	auth, err := vaultAuthFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, AppRoleAuth{RoleID: "role", SecretID: "secret", MountPath: "my-approle"}, auth)
+	os.Unsetenv("VAULT_ROLE_ID")
+	os.Unsetenv("VAULT_SECRET_ID")
+	os.Unsetenv("VAULT_AUTH_PATH")
+
+	os.Setenv("VAULT_K8S_ROLE", "app")
+	auth, err = vaultAuthFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, KubernetesAuth{Role: "app"}, auth)
+	os.Unsetenv("VAULT_K8S_ROLE")
+
+	os.Setenv("VAULT_USERNAME", "bob")
+	_, err = vaultAuthFromEnv()
+	assert.EqualError(t, err, "missing environment variable: VAULT_PASSWORD")
+	os.Unsetenv("VAULT_USERNAME")
+}
@@ -0,0 +1,72 @@
+package dasorm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AWSRole is a role of the vault aws secrets engine
+type AWSRole struct {
+	// Mount is the secrets engine mount. defaults to aws
+	Mount string
+	Role  string
+	// STS requests temporary sts credentials from aws/sts/<role> instead of
+	// an iam user from aws/creds/<role>
+	STS bool
+	// RoleARN picks the role to assume when the vault role allows several
+	RoleARN string
+	// TTL requests a lifetime for sts credentials, e.g. 1h
+	TTL string
+}
+
+// awsEngineCreds is the data returned by the aws secrets engine
+type awsEngineCreds struct {
+	AccessKey     string `vault:"access_key"`
+	SecretKey     string `vault:"secret_key"`
+	SecurityToken string `vault:"security_token,optional"`
+}
+
+func (r AWSRole) path() string {
+	endpoint := "creds"
+	if r.STS {
+		endpoint = "sts"
+	}
+	return mountPath(r.Mount, "aws") + "/" + endpoint + "/" + r.Role
+}
+
+// GetAWSRoleCreds requests credentials from the vault aws secrets engine
+func GetAWSRoleCreds(role AWSRole) (*AWSCreds, error) {
+	client, err := connectVault()
+	if err != nil {
+		return nil, errors.Wrap(err, "connect vault")
+	}
+	data := map[string]interface{}{}
+	if role.RoleARN != "" {
+		data["role_arn"] = role.RoleARN
+	}
+	if role.TTL != "" {
+		data["ttl"] = role.TTL
+	}
+	secret, err := client.Logical().Write(role.path(), data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "write %s", role.path())
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("vault error: no data at: %s", role.path())
+	}
+	engine := &awsEngineCreds{}
+	if err := decodeVault(secret.Data, engine, role.path()); err != nil {
+		return nil, err
+	}
+	creds := &AWSCreds{
+		ID:    engine.AccessKey,
+		Key:   engine.SecretKey,
+		Token: engine.SecurityToken,
+	}
+	if secret.LeaseDuration > 0 {
+		creds.Expires = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+	return creds, nil
+}
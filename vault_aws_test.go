@@ -0,0 +1,44 @@
+package dasorm
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAWSRoleCreds(t *testing.T) {
+	var body map[string]interface{}
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/aws/sts/deploy": func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&body)
+			writeVaultJSON(w, map[string]interface{}{
+				"lease_id":       "aws/sts/deploy/1",
+				"lease_duration": 3600,
+				"data":           map[string]interface{}{"access_key": "AKIA", "secret_key": "secret", "security_token": "token"},
+			})
+		},
+		"/v1/aws/creds/user": func(w http.ResponseWriter, r *http.Request) {
+			writeVaultJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"access_key": "AKIA", "secret_key": "secret", "security_token": nil},
+			})
+		},
+	})
+	SetVaultAuth(TokenAuth{Token: "t"})
+
+	creds, err := GetAWSRoleCreds(AWSRole{Role: "deploy", STS: true, TTL: "1h"})
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIA", creds.ID)
+	assert.Equal(t, "token", creds.Token)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), creds.Expires, time.Minute)
+	assert.Equal(t, map[string]interface{}{"ttl": "1h"}, body)
+
+	creds, err = GetAWSRoleCreds(AWSRole{Role: "user"})
+	assert.NoError(t, err)
+	assert.Equal(t, &AWSCreds{ID: "AKIA", Key: "secret"}, creds)
+
+	_, err = GetAWSRoleCreds(AWSRole{Role: "missing"})
+	assert.Contains(t, err.Error(), "write aws/creds/missing")
+}
@@ -0,0 +1,157 @@
+package dasorm
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// connectConfig opens the pools of provider, dynamic and reconnected connections
+var connectConfig = ConnectDBConfig
+
+// DatabaseRole is a role of the vault database secrets engine
+type DatabaseRole struct {
+	// Mount is the secrets engine mount. defaults to database
+	Mount string
+	Role  string
+}
+
+// ConnectDBDynamic connects with config using credentials leased from a vault
+// database secrets engine role in place of the config's user and password.
+// the lease is renewed in the background and, once it can no longer be
+// extended, the pool is rebuilt with fresh credentials. the old pool is
+// closed and its lease revoked once the statements, transactions and rows
+// using it are done, or after a minute. closing the connection stops the
+// renewal and revokes the current lease.
+func ConnectDBDynamic(config *Config, role DatabaseRole) (*Connection, error) {
+	client, err := connectVault()
+	if err != nil {
+		return nil, errors.Wrap(err, "connect vault")
+	}
+	secret, leased, err := role.credentials(client, config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := connectConfig(leased)
+	if err != nil {
+		role.revoke(client, secret)
+		return nil, err
+	}
+	// leased credentials expire, so the health monitor must not reconnect
+	// with them. rotate replaces the pool instead.
+	conn.DB.source = nil
+	stop := make(chan struct{})
+	conn.DB.onClose(func() { close(stop) })
+	go role.rotate(client, conn, config, secret, stop)
+	return conn, nil
+}
+
+func (r DatabaseRole) path() string {
+	return mountPath(r.Mount, "database") + "/creds/" + r.Role
+}
+
+// credentials leases new credentials and returns a copy of config using them
+func (r DatabaseRole) credentials(client *api.Client, config *Config) (*api.Secret, *Config, error) {
+	secret, err := client.Logical().Read(r.path())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "read %s", r.path())
+	}
+	if secret == nil {
+		return nil, nil, fmt.Errorf("vault error: no data at: %s", r.path())
+	}
+	user, _ := secret.Data["username"].(string)
+	password, _ := secret.Data["password"].(string)
+	if user == "" || password == "" {
+		r.revoke(client, secret)
+		return nil, nil, errors.Errorf("vault error: no credentials at: %s", r.path())
+	}
+	leased := *config
+	leased.User = user
+	leased.Password = password
+	return secret, &leased, nil
+}
+
+// revoke revokes a lease, logging failures
+func (r DatabaseRole) revoke(client *api.Client, secret *api.Secret) {
+	if secret.LeaseID == "" {
+		return
+	}
+	if err := client.Sys().Revoke(secret.LeaseID); err != nil {
+		log.Printf("[dasorm] revoke %s: %v", secret.LeaseID, err)
+	}
+}
+
+// rotate keeps the lease of conn's credentials alive and swaps in a pool with
+// new credentials before it expires
+func (r DatabaseRole) rotate(client *api.Client, conn *Connection, config *Config, secret *api.Secret, stop chan struct{}) {
+	for {
+		if !waitLease(client, secret, stop) {
+			r.revoke(client, secret)
+			return
+		}
+		next, pool, ok := r.reconnect(client, config, stop)
+		if !ok {
+			r.revoke(client, secret)
+			return
+		}
+		old, ok := conn.DB.swapPool(pool)
+		if !ok {
+			pool.Close()
+			r.revoke(client, next)
+			r.revoke(client, secret)
+			return
+		}
+		revoked := secret
+		closeDrained(old, func() { r.revoke(client, revoked) })
+		secret = next
+	}
+}
+
+// reconnect opens a pool with new credentials, retrying until it succeeds or
+// stop is closed
+func (r DatabaseRole) reconnect(client *api.Client, config *Config, stop chan struct{}) (*api.Secret, *sqlx.DB, bool) {
+	for {
+		secret, leased, err := r.credentials(client, config)
+		if err == nil {
+			var conn *Connection
+			if conn, err = connectConfig(leased); err == nil {
+				return secret, conn.DB.pool(), true
+			}
+			r.revoke(client, secret)
+		}
+		log.Printf("[dasorm] rotate %s credentials: %v", r.path(), err)
+		select {
+		case <-stop:
+			return nil, nil, false
+		case <-time.After(vaultReloginInterval):
+		}
+	}
+}
+
+// waitLease renews a lease until it can no longer be extended and reports
+// whether new credentials are needed. leases that cannot be renewed are
+// replaced after two thirds of their duration.
+func waitLease(client *api.Client, secret *api.Secret, stop chan struct{}) bool {
+	if secret.Renewable && secret.LeaseID != "" {
+		renewer, err := client.NewRenewer(&api.RenewerInput{Secret: secret})
+		if err == nil {
+			go renewer.Renew()
+			return waitRenewer(renewer, stop)
+		}
+		log.Printf("[dasorm] renew %s: %v", secret.LeaseID, err)
+	}
+	if secret.LeaseDuration <= 0 {
+		<-stop
+		return false
+	}
+	select {
+	case <-stop:
+		return false
+	case <-time.After(time.Duration(secret.LeaseDuration) * time.Second * 2 / 3):
+		return true
+	}
+}
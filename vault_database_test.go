@@ -0,0 +1,95 @@
+package dasorm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectDBDynamic(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		leases  int
+		revoked []string
+		users   []string
+	)
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/db/creds/app": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			leases++
+			n := leases
+			mu.Unlock()
+			writeVaultJSON(w, map[string]interface{}{
+				"lease_id":       fmt.Sprintf("db/creds/app/%d", n),
+				"lease_duration": 1,
+				"renewable":      false,
+				"data":           map[string]interface{}{"username": fmt.Sprintf("v-app-%d", n), "password": "pw"},
+			})
+		},
+		"/v1/sys/leases/revoke/": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			revoked = append(revoked, strings.TrimPrefix(r.URL.Path, "/v1/sys/leases/revoke/"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		},
+	})
+	SetVaultAuth(TokenAuth{Token: "t"})
+
+	fakes := []*fakeDB{}
+	connectConfig = func(config *Config) (*Connection, error) {
+		conn, fake := newFakeConnection(t, "postgres")
+		mu.Lock()
+		users = append(users, config.User)
+		fakes = append(fakes, fake)
+		mu.Unlock()
+		return conn, nil
+	}
+	defer func() { connectConfig = ConnectDBConfig }()
+
+	conn, err := ConnectDBDynamic(&Config{Dialect: "postgres", Host: "db"}, DatabaseRole{Mount: "db", Role: "app"})
+	assert.NoError(t, err)
+	first := conn.DB.pool()
+	tx, err := conn.Begin()
+	assert.NoError(t, err)
+
+	// the transaction on the old pool keeps it open and its lease alive
+	assert.Eventually(t, func() bool { return conn.DB.pool() != first }, 3*time.Second, 20*time.Millisecond)
+	time.Sleep(3 * drainInterval)
+	mu.Lock()
+	assert.NotContains(t, revoked, "db/creds/app/1")
+	mu.Unlock()
+	_, err = tx.Exec("SELECT 2")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(revoked) > 0 && revoked[0] == "db/creds/app/1"
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Error(t, first.Ping())
+
+	_, err = conn.ExecContext(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(revoked) == leases
+	}, 3*time.Second, 20*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"v-app-1", "v-app-2"}, users[:2])
+	assert.Equal(t, []string{"SELECT 2"}, fakes[0].Statements())
+	stmts := []string{}
+	for _, fake := range fakes[1:] {
+		stmts = append(stmts, fake.Statements()...)
+	}
+	assert.Equal(t, []string{"SELECT 1"}, stmts)
+}
@@ -0,0 +1,157 @@
+package dasorm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultKVMount      = "secret"
+	defaultKVConfigPath = "{environment}/database"
+)
+
+// VaultKV locates secrets in the vault kv store
+type VaultKV struct {
+	// Mount is the kv mount. defaults to secret
+	Mount string
+	// ConfigPath is the path of database configs under the mount.
+	// {environment} is replaced by the environment name. defaults to
+	// {environment}/database
+	ConfigPath string
+	// Version is the kv engine version, 1 or 2. 0 detects it with the mounts api
+	Version int
+}
+
+var (
+	kvMu       sync.Mutex
+	kvSettings *VaultKV
+	kvVersions = map[string]int{}
+)
+
+// SetVaultKV sets where configs and secrets are read from. without it the
+// environment variables VAULT_KV_MOUNT, VAULT_KV_CONFIG_PATH and
+// VAULT_KV_VERSION are used.
+func SetVaultKV(kv VaultKV) {
+	kvMu.Lock()
+	defer kvMu.Unlock()
+	kvSettings = &kv
+	kvVersions = map[string]int{}
+}
+
+// vaultKV returns the kv settings with defaults filled in
+func vaultKV() (VaultKV, error) {
+	kvMu.Lock()
+	settings := kvSettings
+	kvMu.Unlock()
+	var kv VaultKV
+	if settings != nil {
+		kv = *settings
+	} else {
+		kv = VaultKV{
+			Mount:      os.Getenv("VAULT_KV_MOUNT"),
+			ConfigPath: os.Getenv("VAULT_KV_CONFIG_PATH"),
+		}
+		if v := os.Getenv("VAULT_KV_VERSION"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return kv, errors.Wrap(err, "VAULT_KV_VERSION")
+			}
+			kv.Version = n
+		}
+	}
+	kv.Mount = strings.Trim(kv.Mount, "/")
+	if kv.Mount == "" {
+		kv.Mount = defaultKVMount
+	}
+	if kv.ConfigPath == "" {
+		kv.ConfigPath = defaultKVConfigPath
+	}
+	if kv.Version < 0 || kv.Version > 2 {
+		return kv, errors.Errorf("unknown kv version: %d", kv.Version)
+	}
+	return kv, nil
+}
+
+// configPath returns the path of an environment's database config
+func (kv VaultKV) configPath(environment string) string {
+	return strings.Trim(strings.Replace(kv.ConfigPath, "{environment}", environment, -1), "/")
+}
+
+// version returns the configured kv version or asks vault for the version of
+// the mount. vaults that do not expose the mounts api are assumed to run kv v2.
+func (kv VaultKV) version(client *api.Client) (int, error) {
+	if kv.Version != 0 {
+		return kv.Version, nil
+	}
+	kvMu.Lock()
+	v, ok := kvVersions[kv.Mount]
+	kvMu.Unlock()
+	if ok {
+		return v, nil
+	}
+	secret, err := client.Logical().Read("sys/internal/ui/mounts/" + kv.Mount)
+	if err != nil || secret == nil {
+		return 2, nil
+	}
+	switch t, _ := secret.Data["type"].(string); t {
+	case "kv", "generic":
+	default:
+		return 0, errors.Errorf("vault mount %s is a %s engine, not kv", kv.Mount, t)
+	}
+	v = 1
+	if options, ok := secret.Data["options"].(map[string]interface{}); ok && fmt.Sprint(options["version"]) == "2" {
+		v = 2
+	}
+	kvMu.Lock()
+	kvVersions[kv.Mount] = v
+	kvMu.Unlock()
+	return v, nil
+}
+
+// read returns the data stored at path under the mount. version selects a
+// kv v2 secret version, 0 reads the latest.
+func (kv VaultKV) read(client *api.Client, path string, version int) (map[string]interface{}, error) {
+	kvVersion, err := kv.version(client)
+	if err != nil {
+		return nil, err
+	}
+	if kvVersion == 1 {
+		if version != 0 {
+			return nil, errors.Errorf("vault mount %s is kv v1 and has no secret versions", kv.Mount)
+		}
+		secret, err := client.Logical().Read(kv.Mount + "/" + path)
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil || secret.Data == nil {
+			return nil, fmt.Errorf("vault error: no data at: %s", path)
+		}
+		return secret.Data, nil
+	}
+
+	var params map[string][]string
+	if version != 0 {
+		params = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+	secret, err := client.Logical().ReadWithData(kv.Mount+"/data/"+path, params)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("vault error: no data at: %s", path)
+	}
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		if version != 0 {
+			return nil, fmt.Errorf("vault error: version %d of %s is deleted or destroyed", version, path)
+		}
+		return nil, errors.New("failed to parse data from vault response")
+	}
+	return data, nil
+}
@@ -0,0 +1,82 @@
+package dasorm
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testVaultConfig = map[string]interface{}{
+	"dialect":  "mysql",
+	"database": "db",
+	"host":     "localhost",
+	"port":     "3306",
+	"user":     "user",
+	"password": "pass",
+}
+
+func resetVaultKV(t *testing.T) {
+	t.Cleanup(func() {
+		kvMu.Lock()
+		kvSettings = nil
+		kvVersions = map[string]int{}
+		kvMu.Unlock()
+	})
+}
+
+func TestVaultKVv1(t *testing.T) {
+	resetVaultKV(t)
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/sys/internal/ui/mounts/kv-db": func(w http.ResponseWriter, r *http.Request) {
+			writeVaultJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"type": "kv", "path": "kv-db/", "options": map[string]interface{}{"version": "1"}},
+			})
+		},
+		"/v1/kv-db/databases/prod": func(w http.ResponseWriter, r *http.Request) {
+			writeVaultJSON(w, map[string]interface{}{"data": testVaultConfig})
+		},
+	})
+	SetVaultAuth(TokenAuth{Token: "t"})
+	SetVaultKV(VaultKV{Mount: "/kv-db/", ConfigPath: "databases/{environment}"})
+
+	config, err := getConfigVault("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql", config.Dialect)
+	assert.Equal(t, map[string]int{"kv-db": 1}, kvVersions)
+
+	_, err = getConfigVaultVersion("prod", 3)
+	assert.EqualError(t, err, "vault mount kv-db is kv v1 and has no secret versions")
+}
+
+func TestVaultKVv2(t *testing.T) {
+	resetVaultKV(t)
+	var version string
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/secret/data/dev/database": func(w http.ResponseWriter, r *http.Request) {
+			version = r.URL.Query().Get("version")
+			writeVaultJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"data": testVaultConfig},
+			})
+		},
+	})
+	SetVaultAuth(TokenAuth{Token: "t"})
+
+	config, err := getConfigVaultVersion("dev", 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "db", config.Database)
+	assert.Equal(t, "4", version)
+	assert.Empty(t, kvVersions, "fallback version should not be cached")
+}
+
+func TestVaultKVSettings(t *testing.T) {
+	resetVaultKV(t)
+	kv, err := vaultKV()
+	assert.NoError(t, err)
+	assert.Equal(t, VaultKV{Mount: "secret", ConfigPath: "{environment}/database"}, kv)
+	assert.Equal(t, "dev-local/database", kv.configPath("dev-local"))
+
+	SetVaultKV(VaultKV{Version: 3})
+	_, err = vaultKV()
+	assert.EqualError(t, err, "unknown kv version: 3")
+}
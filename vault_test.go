@@ -1,7 +1,13 @@
 package dasorm
 
 import (
+	"encoding/json"
+	"net/http"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestVaultGetEnv(t *testing.T) {
@@ -40,3 +46,72 @@ func TestGetAWSCreds(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestSetVaultField(t *testing.T) {
+	config := &Config{}
+	v := reflect.ValueOf(config).Elem()
+	if err := setVaultField(v.FieldByName("Host"), "localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := setVaultField(v.FieldByName("MaxOpenConns"), json.Number("10")); err != nil {
+		t.Error(err)
+	}
+	if err := setVaultField(v.FieldByName("ConnMaxLifetime"), "5m"); err != nil {
+		t.Error(err)
+	}
+	if err := setVaultField(v.FieldByName("MaxIdleConns"), "asdf"); err == nil {
+		t.Error("should error")
+	}
+	assert.Equal(t, "localhost", config.Host)
+	assert.Equal(t, 10, config.MaxOpenConns)
+	assert.Equal(t, 5*time.Minute, config.ConnMaxLifetime)
+}
+
+func TestParseVaultTag(t *testing.T) {
+	name, optional := parseVaultTag("max_open_conns,optional")
+	assert.Equal(t, "max_open_conns", name)
+	assert.True(t, optional)
+	name, optional = parseVaultTag("host")
+	assert.Equal(t, "host", name)
+	assert.False(t, optional)
+}
+
+func TestDecodeVault(t *testing.T) {
+	type secret struct {
+		Key     string   `vault:"key"`
+		Hosts   []string `vault:"hosts,optional"`
+		Weight  float64  `vault:"weight,optional"`
+		Retries uint     `vault:"retries,optional"`
+		Note    string   `vault:"note,optional"`
+		Ignored string
+	}
+	out := &secret{}
+	err := decodeVault(map[string]interface{}{
+		"key":     "k",
+		"hosts":   "a, b",
+		"weight":  json.Number("0.5"),
+		"retries": "3",
+		"note":    nil,
+		"Ignored": "x",
+	}, out, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, &secret{Key: "k", Hosts: []string{"a", "b"}, Weight: 0.5, Retries: 3}, out)
+
+	err = decodeVault(map[string]interface{}{}, out, "secret test")
+	assert.EqualError(t, err, "could not locate Key in secret test")
+	assert.Error(t, decodeVault(map[string]interface{}{}, secret{}, "test"))
+}
+
+func TestReadSecret(t *testing.T) {
+	resetVaultKV(t)
+	newVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/secret/data/firehose": func(w http.ResponseWriter, r *http.Request) {
+			writeVaultJSON(w, map[string]interface{}{
+				"data": map[string]interface{}{"data": map[string]interface{}{"aws_id": "id"}},
+			})
+		},
+	})
+	SetVaultAuth(TokenAuth{Token: "t"})
+	_, err := GetAWSCreds("firehose")
+	assert.EqualError(t, err, "could not locate Key in secret firehose")
+}
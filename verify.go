@@ -0,0 +1,177 @@
+package dasorm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Drift is a difference between a model and its table that makes queries
+// fail at runtime
+type Drift struct {
+	Table string
+	// Column is empty when the table itself is missing
+	Column  string
+	Problem string
+}
+
+func (d Drift) String() string {
+	if d.Column == "" {
+		return fmt.Sprintf("%s: %s", d.Table, d.Problem)
+	}
+	return fmt.Sprintf("%s.%s: %s", d.Table, d.Column, d.Problem)
+}
+
+// DriftError is returned by VerifyModels when models and tables differ
+type DriftError struct {
+	Drifts []Drift
+}
+
+func (e *DriftError) Error() string {
+	out := make([]string, len(e.Drifts))
+	for i, d := range e.Drifts {
+		out[i] = d.String()
+	}
+	return fmt.Sprintf("%d model drifts: %s", len(e.Drifts), strings.Join(out, "; "))
+}
+
+// type families of the column types reported by the databases
+const (
+	textFamily = iota
+	intFamily
+	decimalFamily
+	floatFamily
+	boolFamily
+	timeFamily
+	uuidFamily
+	// tinyint is both an integer and the boolean of mysql
+	tinyintFamily
+)
+
+var typeFamilies = map[string]int{
+	"CHAR":                        textFamily,
+	"CHARACTER":                   textFamily,
+	"VARCHAR":                     textFamily,
+	"CHARACTER VARYING":           textFamily,
+	"NCHAR":                       textFamily,
+	"NVARCHAR":                    textFamily,
+	"TEXT":                        textFamily,
+	"NTEXT":                       textFamily,
+	"TINYTEXT":                    textFamily,
+	"MEDIUMTEXT":                  textFamily,
+	"LONGTEXT":                    textFamily,
+	"STRING":                      textFamily,
+	"CITEXT":                      textFamily,
+	"ENUM":                        textFamily,
+	"SMALLINT":                    intFamily,
+	"MEDIUMINT":                   intFamily,
+	"INT":                         intFamily,
+	"INTEGER":                     intFamily,
+	"BIGINT":                      intFamily,
+	"TINYINT":                     tinyintFamily,
+	"NUMBER":                      decimalFamily,
+	"NUMERIC":                     decimalFamily,
+	"DECIMAL":                     decimalFamily,
+	"REAL":                        floatFamily,
+	"FLOAT":                       floatFamily,
+	"DOUBLE":                      floatFamily,
+	"DOUBLE PRECISION":            floatFamily,
+	"BOOLEAN":                     boolFamily,
+	"BOOL":                        boolFamily,
+	"BIT":                         boolFamily,
+	"DATE":                        timeFamily,
+	"DATETIME":                    timeFamily,
+	"DATETIME2":                   timeFamily,
+	"SMALLDATETIME":               timeFamily,
+	"DATETIMEOFFSET":              timeFamily,
+	"TIMESTAMP":                   timeFamily,
+	"TIMESTAMP WITHOUT TIME ZONE": timeFamily,
+	"TIMESTAMP WITH TIME ZONE":    timeFamily,
+	"TIMESTAMP_NTZ":               timeFamily,
+	"TIMESTAMP_LTZ":               timeFamily,
+	"TIMESTAMP_TZ":                timeFamily,
+	"UUID":                        uuidFamily,
+	"UNIQUEIDENTIFIER":            uuidFamily,
+}
+
+// compatible reports whether a column can hold the values of a field kind.
+// types it does not know are assumed to be compatible.
+func compatible(kind int, col *Column) bool {
+	dataType := strings.TrimSpace(strings.SplitN(col.DataType, "(", 2)[0])
+	family, ok := typeFamilies[dataType]
+	if !ok {
+		return true
+	}
+	switch kind {
+	case stringColumn:
+		return family == textFamily || family == uuidFamily
+	case uuidColumn:
+		return family == uuidFamily || family == textFamily
+	case smallintColumn, intColumn, bigintColumn:
+		return family == intFamily || family == tinyintFamily || (family == decimalFamily && col.Scale == 0)
+	case realColumn, doubleColumn:
+		return family == floatFamily || family == decimalFamily
+	case boolColumn:
+		return family == boolFamily || family == tinyintFamily
+	case timeColumn:
+		return family == timeFamily
+	}
+	return true
+}
+
+// drifts compares the table of a model with the live one
+func (d *tableDef) drifts(table *Table) []Drift {
+	out := []Drift{}
+	known := map[string]bool{}
+	for _, f := range d.columns {
+		known[strings.ToLower(f.name)] = true
+		col := table.Column(f.name)
+		switch {
+		case col == nil:
+			out = append(out, Drift{Table: d.name, Column: f.name, Problem: "missing column"})
+		case !compatible(f.kind, col):
+			out = append(out, Drift{Table: d.name, Column: f.name, Problem: fmt.Sprintf("%s column cannot hold %s field", col.DataType, f.goType)})
+		}
+	}
+	for _, col := range table.Columns {
+		if known[strings.ToLower(col.Name)] || col.Identity || col.Generated {
+			continue
+		}
+		if !col.Nullable && !col.Default.Valid {
+			out = append(out, Drift{Table: d.name, Column: col.Name, Problem: "column is NOT NULL without a default and not in the model"})
+		}
+	}
+	return out
+}
+
+// VerifyModels compares the `db` fields of models with their live tables
+// and returns a *DriftError listing missing tables and columns, columns whose
+// type cannot hold the field and columns the model lacks that inserts would
+// have to set, so services can check their models on startup.
+//
+//	if err := conn.VerifyModels(&User{}, &Order{}); err != nil {
+//		log.Fatal(err)
+//	}
+func (c *Connection) VerifyModels(models ...interface{}) error {
+	drifts := []Drift{}
+	for _, model := range models {
+		def, err := c.tableDef(model)
+		if err != nil {
+			return errors.Wrap(err, "verify models")
+		}
+		table, err := c.DescribeTable(def.name)
+		if errors.Cause(err) == ErrNoTable {
+			drifts = append(drifts, Drift{Table: def.name, Problem: "missing table"})
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "verify models")
+		}
+		drifts = append(drifts, def.drifts(table)...)
+	}
+	if len(drifts) > 0 {
+		return &DriftError{Drifts: drifts}
+	}
+	return nil
+}
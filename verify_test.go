@@ -0,0 +1,72 @@
+package dasorm
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/estenssoros/dasorm/nulls"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type verifyUser struct {
+	ID      uuid.UUID `db:"id"`
+	Email   string    `db:"email"`
+	OrgID   nulls.Int `db:"org_id"`
+	Created time.Time `db:"created"`
+}
+
+func (verifyUser) TableName() string { return "users" }
+
+type verifyOrder struct {
+	ID int `db:"id"`
+}
+
+func (verifyOrder) TableName() string { return "orders" }
+
+func TestVerifyModels(t *testing.T) {
+	conn, fake := newFakeConnection(t, "postgres")
+	fake.respond = func(query string) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "information_schema.columns") && strings.Contains(query, "'users'") {
+			return []string{"table_schema", "column_name", "data_type", "is_nullable", "column_default", "is_identity", "is_generated"},
+				[][]driver.Value{
+					{"public", "id", "uuid", "NO", nil, "NO", "NO"},
+					{"public", "email", "integer", "NO", nil, "NO", "NO"},
+					{"public", "org_id", "numeric", "YES", nil, "NO", "NO"},
+					{"public", "tenant", "text", "NO", nil, "NO", "NO"},
+					{"public", "note", "text", "YES", nil, "NO", "NO"},
+					{"public", "state", "text", "NO", "'new'", "NO", "NO"},
+					{"public", "seq", "bigint", "NO", nil, "YES", "NO"},
+					{"public", "search", "tsvector", "NO", nil, "NO", "YES"},
+				}
+		}
+		return nil, nil
+	}
+	err := conn.VerifyModels(&verifyUser{}, &[]verifyOrder{})
+	assert.IsType(t, &DriftError{}, err)
+	assert.Equal(t, []Drift{
+		{Table: "users", Column: "email", Problem: "INTEGER column cannot hold string field"},
+		{Table: "users", Column: "created", Problem: "missing column"},
+		{Table: "users", Column: "tenant", Problem: "column is NOT NULL without a default and not in the model"},
+		{Table: "orders", Problem: "missing table"},
+	}, err.(*DriftError).Drifts)
+	assert.Contains(t, err.Error(), "4 model drifts: users.email: INTEGER column cannot hold string field; users.created: missing column")
+
+	fake.respond = describeResponder
+	assert.NoError(t, conn.VerifyModels(&struct {
+		ID    uuid.UUID `db:"id"`
+		Email string    `db:"email"`
+		OrgID int64     `db:"org_id"`
+	}{}))
+}
+
+func TestCompatible(t *testing.T) {
+	assert.True(t, compatible(boolColumn, &Column{DataType: "TINYINT"}))
+	assert.True(t, compatible(bigintColumn, &Column{DataType: "NUMBER"}))
+	assert.False(t, compatible(bigintColumn, &Column{DataType: "NUMBER", Scale: 2}))
+	assert.True(t, compatible(uuidColumn, &Column{DataType: "CHAR(36)"}))
+	assert.False(t, compatible(timeColumn, &Column{DataType: "VARCHAR"}))
+	assert.True(t, compatible(stringColumn, &Column{DataType: "JSONB"}))
+}